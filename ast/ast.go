@@ -23,13 +23,32 @@ type Expression interface {
 	expressionNode()
 }
 
+// TypeExpression is an optional type annotation such as `int`, `[string]`
+// or `fn(int, int): bool`. Annotations are ignored by the evaluator.
+type TypeExpression interface {
+	Node
+	typeNode()
+}
+
+// Pattern is the left-hand side of a match arm. Identifiers bind the
+// matched value, `_` matches anything without binding.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
 type Program struct {
 	Statements []Statement
 }
 
+// LetStatement binds Name, or destructures Value with Pattern when the
+// statement is written `let [a, ...rest] = value;`. Exactly one of Name and
+// Pattern is set.
 type LetStatement struct {
 	Token token.Token
 	Name *Identifier
+	Pattern *ArrayPattern
+	Type TypeExpression
 	Value Expression
 }
 
@@ -68,9 +87,15 @@ type BlockStatement struct {
 	Statements []Statement
 }
 
+// FunctionLiteral parameters may be destructured. For those positions
+// ParameterPatterns holds the pattern and Parameters holds an identifier
+// spelled like the pattern, which cannot clash with a real name.
 type FunctionLiteral struct {
 	Token token.Token
 	Parameters []*Identifier
+	ParameterPatterns []*ArrayPattern
+	ParameterTypes []TypeExpression
+	ReturnType TypeExpression
 	Body *BlockStatement
 }
 
@@ -80,6 +105,30 @@ type CallExpression struct {
 	Arguments []Expression
 }
 
+// StructStatement declares a struct type: `struct Point { x, y }`.
+type StructStatement struct {
+	Token token.Token
+	Name *Identifier
+	Fields []*Identifier
+}
+
+// StructLiteral is `Point{x: 1, y: 2}`, building a struct by field name, or
+// `p{x: 3}`, copying the struct p with some fields replaced. Token is the
+// opening brace.
+type StructLiteral struct {
+	Token token.Token
+	Struct Expression
+	Fields []*Identifier
+	Values []Expression
+}
+
+// MemberExpression is `object.member`, reading a struct field or map key.
+type MemberExpression struct {
+	Token token.Token
+	Object Expression
+	Member *Identifier
+}
+
 type ArrayLiteral struct {
 	Token token.Token
 	Elements []Expression
@@ -91,6 +140,16 @@ type IndexExpression struct {
 	Index Expression
 }
 
+// SliceExpression is `left[start:end]` or `left[start:end:step]`. Omitted
+// bounds are nil.
+type SliceExpression struct {
+	Token token.Token
+	Left Expression
+	Start Expression
+	End Expression
+	Step Expression
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -111,6 +170,54 @@ type Boolean struct {
 	Value bool
 }
 
+type MatchExpression struct {
+	Token token.Token
+	Subject Expression
+	Arms []*MatchArm
+}
+
+// MatchArm is `pattern => body` or `pattern if guard => body`.
+type MatchArm struct {
+	Pattern Pattern
+	Guard Expression
+	Body Expression
+}
+
+type WildcardPattern struct {
+	Token token.Token
+}
+
+// LiteralPattern matches values equal to an integer, string or boolean literal.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+// ArrayPattern matches arrays element by element. Without Rest the array
+// must have exactly len(Elements) elements; with Rest the remainder is bound
+// to it as a new array.
+type ArrayPattern struct {
+	Token token.Token
+	Elements []Pattern
+	Rest *Identifier
+}
+
+type NamedType struct {
+	Token token.Token
+	Name string
+}
+
+type ArrayType struct {
+	Token token.Token
+	Element TypeExpression
+}
+
+type FunctionType struct {
+	Token token.Token
+	Parameters []TypeExpression
+	Return TypeExpression
+}
+
 // Program functions
 func (program *Program) TokenLiteral() string {
 	if len(program.Statements) > 0 {
@@ -129,6 +236,22 @@ func (program *Program) String() string {
 	return out.String()
 }
 
+// StatementToken returns the token a statement starts at. An expression
+// statement's own token is the first token of its expression.
+func StatementToken(stmt Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return stmt.Token
+	case *ReturnStatement:
+		return stmt.Token
+	case *StructStatement:
+		return stmt.Token
+	case *ExpressionStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
 // let statement functions
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
@@ -137,7 +260,14 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -151,6 +281,7 @@ func (ls *LetStatement) String() string {
 
 // identifier functions
 func (identifier *Identifier) expressionNode() {}
+func (identifier *Identifier) patternNode() {}
 func (identifier *Identifier) TokenLiteral() string { return identifier.Token.Literal }
 func (identifier *Identifier) String() string { return identifier.Value }
 
@@ -250,14 +381,22 @@ func (funcLiteral *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range funcLiteral.Parameters {
-		params = append(params, p.String())
+	for i, p := range funcLiteral.Parameters {
+		if i < len(funcLiteral.ParameterTypes) && funcLiteral.ParameterTypes[i] != nil {
+			params = append(params, p.String()+": "+funcLiteral.ParameterTypes[i].String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString(funcLiteral.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(")")
+	if funcLiteral.ReturnType != nil {
+		out.WriteString(": " + funcLiteral.ReturnType.String())
+	}
+	out.WriteString(" ")
 	out.WriteString(funcLiteral.Body.String())
 
 	return out.String()
@@ -283,6 +422,62 @@ func (callExpression *CallExpression) String() string {
 	return out.String()
 }
 
+// Struct statement functions
+func (structStmt *StructStatement) statementNode() {}
+func (structStmt *StructStatement) TokenLiteral() string { return structStmt.Token.Literal }
+func (structStmt *StructStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range structStmt.Fields {
+		fields = append(fields, f.String())
+	}
+
+	out.WriteString(structStmt.TokenLiteral() + " ")
+	out.WriteString(structStmt.Name.String())
+	if len(fields) == 0 {
+		out.WriteString(" {}")
+	} else {
+		out.WriteString(" { " + strings.Join(fields, ", ") + " }")
+	}
+
+	return out.String()
+}
+
+// Struct literal functions
+func (structLiteral *StructLiteral) expressionNode() {}
+func (structLiteral *StructLiteral) TokenLiteral() string { return structLiteral.Token.Literal }
+func (structLiteral *StructLiteral) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for i, f := range structLiteral.Fields {
+		fields = append(fields, f.String()+": "+structLiteral.Values[i].String())
+	}
+
+	out.WriteString(structLiteral.Struct.String())
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Member expression functions
+func (member *MemberExpression) expressionNode() {}
+func (member *MemberExpression) TokenLiteral() string { return member.Token.Literal }
+func (member *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(member.Object.String())
+	out.WriteString(".")
+	out.WriteString(member.Member.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // Array literal functions
 func (array *ArrayLiteral) expressionNode() {}
 func (array *ArrayLiteral) TokenLiteral() string { return array.Token.Literal }
@@ -315,6 +510,31 @@ func (index *IndexExpression) String() string {
 	return out.String()
 }
 
+// Slice expression functions
+func (slice *SliceExpression) expressionNode() {}
+func (slice *SliceExpression) TokenLiteral() string { return slice.Token.Literal }
+func (slice *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(slice.Left.String())
+	out.WriteString("[")
+	if slice.Start != nil {
+		out.WriteString(slice.Start.String())
+	}
+	out.WriteString(":")
+	if slice.End != nil {
+		out.WriteString(slice.End.String())
+	}
+	if slice.Step != nil {
+		out.WriteString(":")
+		out.WriteString(slice.Step.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // String literal functions
 func (str *StringLiteral) expressionNode() {}
 func (str *StringLiteral) TokenLiteral() string { return str.Token.Literal }
@@ -329,3 +549,93 @@ func (intLiteral *IntegerLiteral) String() string {return intLiteral.Token.Liter
 func (boolean *Boolean) expressionNode() {}
 func (boolean *Boolean) TokenLiteral() string { return boolean.Token.Literal }
 func (boolean *Boolean) String() string {return boolean.Token.Literal}
+
+// Match expression functions
+func (match *MatchExpression) expressionNode() {}
+func (match *MatchExpression) TokenLiteral() string { return match.Token.Literal }
+func (match *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range match.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(match.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (arm *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(arm.Pattern.String())
+	if arm.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(arm.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(arm.Body.String())
+
+	return out.String()
+}
+
+// Pattern functions
+func (wildcard *WildcardPattern) patternNode() {}
+func (wildcard *WildcardPattern) TokenLiteral() string { return wildcard.Token.Literal }
+func (wildcard *WildcardPattern) String() string { return "_" }
+
+func (literal *LiteralPattern) patternNode() {}
+func (literal *LiteralPattern) TokenLiteral() string { return literal.Token.Literal }
+func (literal *LiteralPattern) String() string { return literal.Value.String() }
+
+func (arrayPattern *ArrayPattern) patternNode() {}
+func (arrayPattern *ArrayPattern) TokenLiteral() string { return arrayPattern.Token.Literal }
+func (arrayPattern *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range arrayPattern.Elements {
+		elements = append(elements, el.String())
+	}
+	if arrayPattern.Rest != nil {
+		elements = append(elements, "..."+arrayPattern.Rest.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// Type annotation functions
+func (named *NamedType) typeNode() {}
+func (named *NamedType) TokenLiteral() string { return named.Token.Literal }
+func (named *NamedType) String() string { return named.Name }
+
+func (arrayType *ArrayType) typeNode() {}
+func (arrayType *ArrayType) TokenLiteral() string { return arrayType.Token.Literal }
+func (arrayType *ArrayType) String() string { return "[" + arrayType.Element.String() + "]" }
+
+func (fnType *FunctionType) typeNode() {}
+func (fnType *FunctionType) TokenLiteral() string { return fnType.Token.Literal }
+func (fnType *FunctionType) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fnType.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString("): ")
+	out.WriteString(fnType.Return.String())
+
+	return out.String()
+}
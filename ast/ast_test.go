@@ -26,3 +26,86 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestStatementToken(t *testing.T) {
+	at := func(typ token.TokenType, literal string, line int) token.Token {
+		return token.Token{Type: typ, Literal: literal, Line: line, Column: 1}
+	}
+	tests := []struct {
+		stmt     Statement
+		expected token.Token
+	}{
+		{&LetStatement{Token: at(token.LET, "let", 1)}, at(token.LET, "let", 1)},
+		{&ReturnStatement{Token: at(token.RETURN, "return", 2)}, at(token.RETURN, "return", 2)},
+		{&StructStatement{Token: at(token.STRUCT, "struct", 3)}, at(token.STRUCT, "struct", 3)},
+		{&ExpressionStatement{Token: at(token.IDENT, "x", 4)}, at(token.IDENT, "x", 4)},
+	}
+
+	for _, tt := range tests {
+		if got := StatementToken(tt.stmt); got != tt.expected {
+			t.Errorf("StatementToken(%T) = %+v, want %+v", tt.stmt, got, tt.expected)
+		}
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	node := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+", Line: 1, Column: 3},
+		Operator: "+",
+		Left:     &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Line: 1, Column: 1}, Value: 1},
+		Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"},
+	}
+
+	expected := `{"type":"InfixExpression","token":{"type":"+","literal":"+","line":1,"column":3},"operator":"+",` +
+		`"left":{"type":"IntegerLiteral","token":{"type":"INT","literal":"1","line":1,"column":1},"value":1},` +
+		`"right":{"type":"Identifier","token":{"type":"IDENT","literal":"x","line":1,"column":5},"value":"x"}}`
+	if string(ToJSON(node)) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=%s", expected, ToJSON(node))
+	}
+
+	decoded, err := FromJSON([]byte(expected))
+	if err != nil {
+		t.Fatalf("FromJSON failed: %s", err)
+	}
+	if decoded.String() != "(1 + x)" {
+		t.Errorf("decoded wrong node. got=%q", decoded.String())
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type":"Nonsense"}`, `ast: unknown node type "Nonsense"`},
+		{`{"type":"ExpressionStatement","expression":{"type":"WildcardPattern"}}`, "ast: expected expression, got *ast.WildcardPattern"},
+		{`{"type":"IntegerLiteral","value":"one"}`, "ast: json: cannot unmarshal string into Go value of type int64"},
+		{`null`, "ast: no node in JSON input"},
+	}
+
+	for _, tt := range tests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	node := &PrefixExpression{
+		Token:    token.Token{Type: token.BANG, Literal: "!", Line: 1, Column: 1},
+		Operator: "!",
+		Right:    &Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Line: 1, Column: 2}, Value: true},
+	}
+
+	expected := `digraph ast {
+	node [shape=box, fontname="monospace"];
+	n0 [label="PrefixExpression\noperator: !\n\"!\" @ 1:1"];
+	n1 [label="Boolean\nvalue: true\n\"true\" @ 1:2"];
+	n0 -> n1 [label="right"];
+}
+`
+	if ToDOT(node) != expected {
+		t.Errorf("wrong DOT.\nexpected=%s\ngot=%s", expected, ToDOT(node))
+	}
+}
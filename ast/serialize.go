@@ -0,0 +1,609 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// tree is the serialized shape of a node shared by the JSON and DOT
+// encoders: the node type, its token, scalar attributes such as an operator,
+// and named children in source order.
+type tree struct {
+	kind     string
+	token    *token.Token
+	attrs    []attr
+	children []child
+}
+
+type attr struct {
+	name  string
+	value interface{}
+}
+
+// child is a single node or, if list is set, a list of nodes. Absent
+// optional nodes are nil.
+type child struct {
+	name  string
+	list  bool
+	trees []*tree
+}
+
+// ToJSON encodes node as a JSON tree. Every node is an object with its
+// "type", its "token" including position, and one key per attribute or child.
+func ToJSON(node Node) []byte {
+	var out bytes.Buffer
+	build(node).writeJSON(&out)
+	return out.Bytes()
+}
+
+// ToDOT renders node as a Graphviz digraph with one box per node and edges
+// labelled with the child's name.
+func ToDOT(node Node) string {
+	var out bytes.Buffer
+	out.WriteString("digraph ast {\n")
+	out.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	next := 0
+	var visit func(t *tree) string
+	visit = func(t *tree) string {
+		id := fmt.Sprintf("n%d", next)
+		next++
+
+		fmt.Fprintf(&out, "\t%s [label=%s];\n", id, strconv.Quote(t.label()))
+		for _, c := range t.children {
+			for i, childTree := range c.trees {
+				if childTree == nil {
+					continue
+				}
+				name := c.name
+				if c.list {
+					name = fmt.Sprintf("%s[%d]", c.name, i)
+				}
+				childId := visit(childTree)
+				fmt.Fprintf(&out, "\t%s -> %s [label=%s];\n", id, childId, strconv.Quote(name))
+			}
+		}
+		return id
+	}
+	visit(build(node))
+
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func (t *tree) label() string {
+	lines := []string{t.kind}
+	for _, a := range t.attrs {
+		lines = append(lines, fmt.Sprintf("%s: %v", a.name, a.value))
+	}
+	if t.token != nil {
+		lines = append(lines, fmt.Sprintf("%q @ %d:%d", t.token.Literal, t.token.Line, t.token.Column))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t *tree) writeJSON(out *bytes.Buffer) {
+	out.WriteString(`{"type":`)
+	writeJSONValue(out, t.kind)
+	if t.token != nil {
+		out.WriteString(`,"token":`)
+		writeJSONValue(out, t.token)
+	}
+	for _, a := range t.attrs {
+		out.WriteString(",")
+		writeJSONValue(out, a.name)
+		out.WriteString(":")
+		writeJSONValue(out, a.value)
+	}
+	for _, c := range t.children {
+		out.WriteString(",")
+		writeJSONValue(out, c.name)
+		out.WriteString(":")
+		if c.list {
+			out.WriteString("[")
+		}
+		for i, childTree := range c.trees {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			if childTree == nil {
+				out.WriteString("null")
+			} else {
+				childTree.writeJSON(out)
+			}
+		}
+		if c.list {
+			out.WriteString("]")
+		}
+	}
+	out.WriteString("}")
+}
+
+// writeJSONValue writes a string, number, bool or token, none of which can
+// fail to encode.
+func writeJSONValue(out *bytes.Buffer, v interface{}) {
+	data, _ := json.Marshal(v)
+	out.Write(data)
+}
+
+func build(node Node) *tree {
+	if isNilNode(node) {
+		return nil
+	}
+
+	t := &tree{kind: reflect.TypeOf(node).Elem().Name()}
+	one := func(name string, n Node) {
+		t.children = append(t.children, child{name: name, trees: []*tree{build(n)}})
+	}
+	many := func(name string, nodes []Node) {
+		trees := []*tree{}
+		for _, n := range nodes {
+			trees = append(trees, build(n))
+		}
+		t.children = append(t.children, child{name: name, list: true, trees: trees})
+	}
+	attribute := func(name string, value interface{}) {
+		t.attrs = append(t.attrs, attr{name: name, value: value})
+	}
+	tok := func(tok token.Token) {
+		t.token = &tok
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		nodes := []Node{}
+		for _, s := range node.Statements {
+			nodes = append(nodes, s)
+		}
+		many("statements", nodes)
+	case *LetStatement:
+		tok(node.Token)
+		one("name", node.Name)
+		one("pattern", node.Pattern)
+		one("annotation", node.Type)
+		one("value", node.Value)
+	case *ReturnStatement:
+		tok(node.Token)
+		one("returnValue", node.ReturnValue)
+	case *ExpressionStatement:
+		tok(node.Token)
+		one("expression", node.Expression)
+	case *BlockStatement:
+		tok(node.Token)
+		nodes := []Node{}
+		for _, s := range node.Statements {
+			nodes = append(nodes, s)
+		}
+		many("statements", nodes)
+	case *PrefixExpression:
+		tok(node.Token)
+		attribute("operator", node.Operator)
+		one("right", node.Right)
+	case *InfixExpression:
+		tok(node.Token)
+		attribute("operator", node.Operator)
+		one("left", node.Left)
+		one("right", node.Right)
+	case *IfExpression:
+		tok(node.Token)
+		one("condition", node.Condition)
+		one("consequence", node.Consequence)
+		one("alternative", node.Alternative)
+	case *FunctionLiteral:
+		tok(node.Token)
+		params, patterns, types := []Node{}, []Node{}, []Node{}
+		for _, p := range node.Parameters {
+			params = append(params, p)
+		}
+		for _, p := range node.ParameterPatterns {
+			patterns = append(patterns, p)
+		}
+		for _, p := range node.ParameterTypes {
+			types = append(types, p)
+		}
+		many("parameters", params)
+		many("parameterPatterns", patterns)
+		many("parameterTypes", types)
+		one("returnType", node.ReturnType)
+		one("body", node.Body)
+	case *CallExpression:
+		tok(node.Token)
+		one("function", node.Function)
+		args := []Node{}
+		for _, a := range node.Arguments {
+			args = append(args, a)
+		}
+		many("arguments", args)
+	case *StructStatement:
+		tok(node.Token)
+		one("name", node.Name)
+		fields := []Node{}
+		for _, f := range node.Fields {
+			fields = append(fields, f)
+		}
+		many("fields", fields)
+	case *StructLiteral:
+		tok(node.Token)
+		one("struct", node.Struct)
+		fields, values := []Node{}, []Node{}
+		for i, f := range node.Fields {
+			fields = append(fields, f)
+			values = append(values, node.Values[i])
+		}
+		many("fields", fields)
+		many("values", values)
+	case *MemberExpression:
+		tok(node.Token)
+		one("object", node.Object)
+		one("member", node.Member)
+	case *ArrayLiteral:
+		tok(node.Token)
+		elements := []Node{}
+		for _, el := range node.Elements {
+			elements = append(elements, el)
+		}
+		many("elements", elements)
+	case *IndexExpression:
+		tok(node.Token)
+		one("left", node.Left)
+		one("index", node.Index)
+	case *SliceExpression:
+		tok(node.Token)
+		one("left", node.Left)
+		one("start", node.Start)
+		one("end", node.End)
+		one("step", node.Step)
+	case *StringLiteral:
+		tok(node.Token)
+		attribute("value", node.Value)
+	case *IntegerLiteral:
+		tok(node.Token)
+		attribute("value", node.Value)
+	case *Identifier:
+		tok(node.Token)
+		attribute("value", node.Value)
+	case *Boolean:
+		tok(node.Token)
+		attribute("value", node.Value)
+	case *MatchExpression:
+		tok(node.Token)
+		one("subject", node.Subject)
+		arms := []*tree{}
+		for _, arm := range node.Arms {
+			armTree := &tree{kind: "MatchArm"}
+			for _, part := range []struct {
+				name string
+				node Node
+			}{{"pattern", arm.Pattern}, {"guard", arm.Guard}, {"body", arm.Body}} {
+				armTree.children = append(armTree.children, child{name: part.name, trees: []*tree{build(part.node)}})
+			}
+			arms = append(arms, armTree)
+		}
+		t.children = append(t.children, child{name: "arms", list: true, trees: arms})
+	case *WildcardPattern:
+		tok(node.Token)
+	case *LiteralPattern:
+		tok(node.Token)
+		one("value", node.Value)
+	case *ArrayPattern:
+		tok(node.Token)
+		elements := []Node{}
+		for _, el := range node.Elements {
+			elements = append(elements, el)
+		}
+		many("elements", elements)
+		one("rest", node.Rest)
+	case *NamedType:
+		tok(node.Token)
+		attribute("name", node.Name)
+	case *ArrayType:
+		tok(node.Token)
+		one("element", node.Element)
+	case *FunctionType:
+		tok(node.Token)
+		params := []Node{}
+		for _, p := range node.Parameters {
+			params = append(params, p)
+		}
+		many("parameters", params)
+		one("return", node.Return)
+	default:
+		panic(fmt.Sprintf("ast: cannot serialize %T", node))
+	}
+
+	return t
+}
+
+// FromJSON decodes a tree produced by ToJSON.
+func FromJSON(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node(data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("ast: no node in JSON input")
+	}
+	return node, nil
+}
+
+// decoder rebuilds nodes from JSON, remembering the first error so the
+// per-type code can read fields without checking each one.
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: "+format, a...)
+	}
+}
+
+func (d *decoder) value(raw json.RawMessage, v interface{}) {
+	if d.err != nil || raw == nil {
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		d.fail("%s", err)
+	}
+}
+
+func (d *decoder) list(raw json.RawMessage) []json.RawMessage {
+	items := []json.RawMessage{}
+	d.value(raw, &items)
+	return items
+}
+
+func (d *decoder) node(raw json.RawMessage) Node {
+	if d.err != nil || raw == nil || string(raw) == "null" {
+		return nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	d.value(raw, &fields)
+
+	var kind string
+	d.value(fields["type"], &kind)
+
+	var tok token.Token
+	d.value(fields["token"], &tok)
+
+	switch kind {
+	case "Program":
+		program := &Program{Statements: []Statement{}}
+		for _, s := range d.list(fields["statements"]) {
+			program.Statements = append(program.Statements, d.statement(s))
+		}
+		return program
+	case "LetStatement":
+		return &LetStatement{
+			Token:   tok,
+			Name:    d.identifier(fields["name"]),
+			Pattern: d.arrayPattern(fields["pattern"]),
+			Type:    d.typeExpression(fields["annotation"]),
+			Value:   d.expression(fields["value"]),
+		}
+	case "ReturnStatement":
+		return &ReturnStatement{Token: tok, ReturnValue: d.expression(fields["returnValue"])}
+	case "ExpressionStatement":
+		return &ExpressionStatement{Token: tok, Expression: d.expression(fields["expression"])}
+	case "BlockStatement":
+		block := &BlockStatement{Token: tok, Statements: []Statement{}}
+		for _, s := range d.list(fields["statements"]) {
+			block.Statements = append(block.Statements, d.statement(s))
+		}
+		return block
+	case "PrefixExpression":
+		prefix := &PrefixExpression{Token: tok, Right: d.expression(fields["right"])}
+		d.value(fields["operator"], &prefix.Operator)
+		return prefix
+	case "InfixExpression":
+		infix := &InfixExpression{Token: tok, Left: d.expression(fields["left"]), Right: d.expression(fields["right"])}
+		d.value(fields["operator"], &infix.Operator)
+		return infix
+	case "IfExpression":
+		return &IfExpression{
+			Token:       tok,
+			Condition:   d.expression(fields["condition"]),
+			Consequence: d.block(fields["consequence"]),
+			Alternative: d.block(fields["alternative"]),
+		}
+	case "FunctionLiteral":
+		fn := &FunctionLiteral{Token: tok, ReturnType: d.typeExpression(fields["returnType"]), Body: d.block(fields["body"])}
+		fn.Parameters = []*Identifier{}
+		for _, p := range d.list(fields["parameters"]) {
+			fn.Parameters = append(fn.Parameters, d.identifier(p))
+		}
+		for _, p := range d.list(fields["parameterPatterns"]) {
+			fn.ParameterPatterns = append(fn.ParameterPatterns, d.arrayPattern(p))
+		}
+		for _, p := range d.list(fields["parameterTypes"]) {
+			fn.ParameterTypes = append(fn.ParameterTypes, d.typeExpression(p))
+		}
+		return fn
+	case "CallExpression":
+		call := &CallExpression{Token: tok, Function: d.expression(fields["function"]), Arguments: []Expression{}}
+		for _, a := range d.list(fields["arguments"]) {
+			call.Arguments = append(call.Arguments, d.expression(a))
+		}
+		return call
+	case "StructStatement":
+		stmt := &StructStatement{Token: tok, Name: d.identifier(fields["name"]), Fields: []*Identifier{}}
+		for _, f := range d.list(fields["fields"]) {
+			stmt.Fields = append(stmt.Fields, d.identifier(f))
+		}
+		return stmt
+	case "StructLiteral":
+		literal := &StructLiteral{Token: tok, Struct: d.expression(fields["struct"]), Fields: []*Identifier{}, Values: []Expression{}}
+		for _, f := range d.list(fields["fields"]) {
+			literal.Fields = append(literal.Fields, d.identifier(f))
+		}
+		for _, v := range d.list(fields["values"]) {
+			literal.Values = append(literal.Values, d.expression(v))
+		}
+		if len(literal.Fields) != len(literal.Values) {
+			d.fail("StructLiteral has %d fields but %d values", len(literal.Fields), len(literal.Values))
+		}
+		return literal
+	case "MemberExpression":
+		return &MemberExpression{Token: tok, Object: d.expression(fields["object"]), Member: d.identifier(fields["member"])}
+	case "ArrayLiteral":
+		array := &ArrayLiteral{Token: tok, Elements: []Expression{}}
+		for _, el := range d.list(fields["elements"]) {
+			array.Elements = append(array.Elements, d.expression(el))
+		}
+		return array
+	case "IndexExpression":
+		return &IndexExpression{Token: tok, Left: d.expression(fields["left"]), Index: d.expression(fields["index"])}
+	case "SliceExpression":
+		return &SliceExpression{
+			Token: tok,
+			Left:  d.expression(fields["left"]),
+			Start: d.expression(fields["start"]),
+			End:   d.expression(fields["end"]),
+			Step:  d.expression(fields["step"]),
+		}
+	case "StringLiteral":
+		str := &StringLiteral{Token: tok}
+		d.value(fields["value"], &str.Value)
+		return str
+	case "IntegerLiteral":
+		integer := &IntegerLiteral{Token: tok}
+		d.value(fields["value"], &integer.Value)
+		return integer
+	case "Identifier":
+		ident := &Identifier{Token: tok}
+		d.value(fields["value"], &ident.Value)
+		return ident
+	case "Boolean":
+		boolean := &Boolean{Token: tok}
+		d.value(fields["value"], &boolean.Value)
+		return boolean
+	case "MatchExpression":
+		match := &MatchExpression{Token: tok, Subject: d.expression(fields["subject"])}
+		for _, raw := range d.list(fields["arms"]) {
+			armFields := map[string]json.RawMessage{}
+			d.value(raw, &armFields)
+			match.Arms = append(match.Arms, &MatchArm{
+				Pattern: d.pattern(armFields["pattern"]),
+				Guard:   d.expression(armFields["guard"]),
+				Body:    d.expression(armFields["body"]),
+			})
+		}
+		return match
+	case "WildcardPattern":
+		return &WildcardPattern{Token: tok}
+	case "LiteralPattern":
+		return &LiteralPattern{Token: tok, Value: d.expression(fields["value"])}
+	case "ArrayPattern":
+		pattern := &ArrayPattern{Token: tok, Elements: []Pattern{}, Rest: d.identifier(fields["rest"])}
+		for _, el := range d.list(fields["elements"]) {
+			pattern.Elements = append(pattern.Elements, d.pattern(el))
+		}
+		return pattern
+	case "NamedType":
+		named := &NamedType{Token: tok}
+		d.value(fields["name"], &named.Name)
+		return named
+	case "ArrayType":
+		return &ArrayType{Token: tok, Element: d.typeExpression(fields["element"])}
+	case "FunctionType":
+		fnType := &FunctionType{Token: tok, Return: d.typeExpression(fields["return"])}
+		for _, p := range d.list(fields["parameters"]) {
+			fnType.Parameters = append(fnType.Parameters, d.typeExpression(p))
+		}
+		return fnType
+	}
+
+	d.fail("unknown node type %q", kind)
+	return nil
+}
+
+func (d *decoder) statement(raw json.RawMessage) Statement {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	stmt, ok := node.(Statement)
+	if !ok {
+		d.fail("expected statement, got %T", node)
+	}
+	return stmt
+}
+
+func (d *decoder) expression(raw json.RawMessage) Expression {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		d.fail("expected expression, got %T", node)
+	}
+	return exp
+}
+
+func (d *decoder) block(raw json.RawMessage) *BlockStatement {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("expected BlockStatement, got %T", node)
+	}
+	return block
+}
+
+func (d *decoder) identifier(raw json.RawMessage) *Identifier {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.fail("expected Identifier, got %T", node)
+	}
+	return ident
+}
+
+func (d *decoder) pattern(raw json.RawMessage) Pattern {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	pattern, ok := node.(Pattern)
+	if !ok {
+		d.fail("expected pattern, got %T", node)
+	}
+	return pattern
+}
+
+func (d *decoder) arrayPattern(raw json.RawMessage) *ArrayPattern {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	pattern, ok := node.(*ArrayPattern)
+	if !ok {
+		d.fail("expected ArrayPattern, got %T", node)
+	}
+	return pattern
+}
+
+func (d *decoder) typeExpression(raw json.RawMessage) TypeExpression {
+	node := d.node(raw)
+	if node == nil {
+		return nil
+	}
+	typ, ok := node.(TypeExpression)
+	if !ok {
+		d.fail("expected type, got %T", node)
+	}
+	return typ
+}
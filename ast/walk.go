@@ -0,0 +1,104 @@
+package ast
+
+import "reflect"
+
+// Walk calls visit for node and then, if visit returns true, for each of its
+// children in source order. Absent optional children are skipped. Match arms
+// are not nodes themselves; their patterns, guards and bodies are visited as
+// children of the match expression.
+func Walk(node Node, visit func(Node) bool) {
+	if isNilNode(node) || !visit(node) {
+		return
+	}
+
+	walk := func(children ...Node) {
+		for _, child := range children {
+			Walk(child, visit)
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			walk(s)
+		}
+	case *LetStatement:
+		walk(node.Name, node.Pattern, node.Type, node.Value)
+	case *ReturnStatement:
+		walk(node.ReturnValue)
+	case *ExpressionStatement:
+		walk(node.Expression)
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			walk(s)
+		}
+	case *PrefixExpression:
+		walk(node.Right)
+	case *InfixExpression:
+		walk(node.Left, node.Right)
+	case *IfExpression:
+		walk(node.Condition, node.Consequence, node.Alternative)
+	case *FunctionLiteral:
+		for i, p := range node.Parameters {
+			if i < len(node.ParameterPatterns) && node.ParameterPatterns[i] != nil {
+				walk(node.ParameterPatterns[i])
+			} else {
+				walk(p)
+			}
+			if i < len(node.ParameterTypes) {
+				walk(node.ParameterTypes[i])
+			}
+		}
+		walk(node.ReturnType, node.Body)
+	case *CallExpression:
+		walk(node.Function)
+		for _, a := range node.Arguments {
+			walk(a)
+		}
+	case *StructStatement:
+		walk(node.Name)
+		for _, f := range node.Fields {
+			walk(f)
+		}
+	case *StructLiteral:
+		walk(node.Struct)
+		for i, f := range node.Fields {
+			walk(f, node.Values[i])
+		}
+	case *MemberExpression:
+		walk(node.Object, node.Member)
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			walk(el)
+		}
+	case *IndexExpression:
+		walk(node.Left, node.Index)
+	case *SliceExpression:
+		walk(node.Left, node.Start, node.End, node.Step)
+	case *MatchExpression:
+		walk(node.Subject)
+		for _, arm := range node.Arms {
+			walk(arm.Pattern, arm.Guard, arm.Body)
+		}
+	case *LiteralPattern:
+		walk(node.Value)
+	case *ArrayPattern:
+		for _, el := range node.Elements {
+			walk(el)
+		}
+		walk(node.Rest)
+	case *ArrayType:
+		walk(node.Element)
+	case *FunctionType:
+		for _, p := range node.Parameters {
+			walk(p)
+		}
+		walk(node.Return)
+	}
+}
+
+// isNilNode reports whether node is nil or a nil pointer, as an absent
+// optional child such as a missing else block is.
+func isNilNode(node Node) bool {
+	return node == nil || reflect.ValueOf(node).IsNil()
+}
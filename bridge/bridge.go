@@ -0,0 +1,481 @@
+// Package bridge converts between Go values and Monkey objects, so host
+// programs can hand data to scripts and read their results back without
+// building object trees by hand.
+//
+// Structs become maps of their exported fields in declaration order, named
+// by their `monkey` tag if they have one. A tag of "-" leaves the field out
+// and the option omitempty leaves it out when it has its zero value:
+//
+//	type Point struct {
+//		X     int    `monkey:"x"`
+//		Label string `monkey:"label,omitempty"`
+//	}
+//
+// Maps become maps with sorted keys, slices and arrays become arrays, and
+// time.Time and time.Duration become strings in RFC 3339 and
+// time.Duration.String form. Go functions become builtins that convert
+// their arguments and results.
+package bridge
+
+import (
+	"encoding"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	objectType   = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// ToObject converts v to an object. Values that are already objects are
+// returned as they are. Values of types that have no Monkey equivalent,
+// such as channels, and values that contain themselves convert to an
+// *object.Error.
+func ToObject(v any) object.Object {
+	c := &converter{visiting: map[visit]bool{}}
+	obj, err := c.toObject(reflect.ValueOf(v))
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return obj
+}
+
+// converter converts one value for ToObject. It remembers the pointers,
+// maps and slices it is inside of, so that a value containing itself is
+// reported instead of recursing forever, as encoding/json does.
+type converter struct {
+	visiting map[visit]bool
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func (c *converter) toObject(v reflect.Value) (object.Object, error) {
+	if !v.IsValid() {
+		return evaluator.NULL, nil
+	}
+	if v.Type().Implements(objectType) && v.Type().Kind() != reflect.Interface {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		return &object.String{Value: v.Interface().(time.Time).Format(time.RFC3339Nano)}, nil
+	case durationType:
+		return &object.String{Value: v.Interface().(time.Duration).String()}, nil
+	case bytesType:
+		return &object.String{Value: string(v.Bytes())}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			key := visit{ptr: v.Pointer(), typ: v.Type()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if c.visiting[key] {
+				return nil, fmt.Errorf("bridge: encountered a cycle via %s", v.Type())
+			}
+			c.visiting[key] = true
+			defer delete(c.visiting, key)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return c.toObject(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("bridge: %d overflows INTEGER", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := c.toObject(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return c.mapToObject(v)
+	case reflect.Struct:
+		return c.structToObject(v)
+	case reflect.Func:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return wrapFunc(v), nil
+	}
+	return nil, fmt.Errorf("bridge: cannot convert %s", v.Type())
+}
+
+func (c *converter) mapToObject(v reflect.Value) (object.Object, error) {
+	keys := make([]string, 0, v.Len())
+	values := map[string]reflect.Value{}
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := keyString(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+
+	m := object.NewMap()
+	for _, key := range keys {
+		val, err := c.toObject(values[key])
+		if err != nil {
+			return nil, err
+		}
+		m.Set(key, val)
+	}
+	return m, nil
+}
+
+// keyString converts a map key to a string the way encoding/json does.
+func keyString(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("bridge: cannot convert map key of type %s", key.Type())
+}
+
+func (c *converter) structToObject(v reflect.Value) (object.Object, error) {
+	m := object.NewMap()
+	for _, f := range fields(v.Type()) {
+		field := v.Field(f.index)
+		if f.omitEmpty && field.IsZero() {
+			continue
+		}
+		val, err := c.toObject(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w (field %s)", err, f.name)
+		}
+		m.Set(f.name, val)
+	}
+	return m, nil
+}
+
+// field is an exported struct field as scripts see it.
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func fields(t reflect.Type) []field {
+	result := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("monkey")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		result = append(result, field{name: name, index: i, omitEmpty: options == "omitempty"})
+	}
+	return result
+}
+
+// FromObject stores obj in the value target points to, converting it to
+// its type as ToObject would convert the other way. Maps, and Monkey
+// structs, fill structs by field name, ignoring keys with no field. A target
+// of type any gets nil, bool, int64, float64, string, []any or
+// map[string]any, or the object itself if it is none of those. A nil obj
+// is taken as null.
+func FromObject(obj object.Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("bridge: FromObject needs a non-nil pointer, got %T", target)
+	}
+	return fromObject(obj, v.Elem(), "")
+}
+
+// fromObject stores obj in v. path locates v within the outermost target,
+// for error messages.
+func fromObject(obj object.Object, v reflect.Value, path string) error {
+	// Eval returns nil for programs that end in a statement without a value.
+	if obj == nil {
+		obj = evaluator.NULL
+	}
+	mismatch := func() error {
+		return fmt.Errorf("bridge: %scannot convert %s to %s", prefix(path), obj.Type(), v.Type())
+	}
+
+	// Targets of object types take objects as they are.
+	if v.Type() == objectType {
+		v.Set(reflect.ValueOf(&obj).Elem())
+		return nil
+	}
+	if v.Kind() != reflect.Interface && reflect.TypeOf(obj).AssignableTo(v.Type()) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return mismatch()
+		}
+		t, err := time.Parse(time.RFC3339Nano, s.Value)
+		if err != nil {
+			return fmt.Errorf("bridge: %s%w", prefix(path), err)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		switch obj := obj.(type) {
+		case *object.Integer:
+			v.SetInt(obj.Value)
+			return nil
+		case *object.String:
+			d, err := time.ParseDuration(obj.Value)
+			if err != nil {
+				return fmt.Errorf("bridge: %s%w", prefix(path), err)
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		return mismatch()
+	case bytesType:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBytes([]byte(s.Value))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch()
+		}
+		if natural := naturalValue(obj); natural == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(natural))
+		}
+		return nil
+	case reflect.Ptr:
+		if obj == evaluator.NULL {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return fromObject(obj, v.Elem(), path)
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b.Value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		if v.OverflowInt(n.Value) {
+			return fmt.Errorf("bridge: %s%d overflows %s", prefix(path), n.Value, v.Type())
+		}
+		v.SetInt(n.Value)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		if n.Value < 0 || v.OverflowUint(uint64(n.Value)) {
+			return fmt.Errorf("bridge: %s%d overflows %s", prefix(path), n.Value, v.Type())
+		}
+		v.SetUint(uint64(n.Value))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *object.Integer:
+			v.SetFloat(float64(n.Value))
+		case *object.Float:
+			v.SetFloat(n.Value)
+		default:
+			return mismatch()
+		}
+		return nil
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(s.Value)
+		return nil
+	case reflect.Slice, reflect.Array:
+		if obj == evaluator.NULL && v.Kind() == reflect.Slice {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch()
+		}
+		if v.Kind() == reflect.Array && len(array.Elements) != v.Len() {
+			return fmt.Errorf("bridge: %scannot convert %d elements to %s", prefix(path), len(array.Elements), v.Type())
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(array.Elements), len(array.Elements)))
+		}
+		for i, el := range array.Elements {
+			if err := fromObject(el, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if obj == evaluator.NULL {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		m, ok := asMap(obj)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), m.Len()))
+		for _, key := range m.Keys() {
+			val, _ := m.Get(key)
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := fromObject(val, elem, path+"."+key); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Struct:
+		m, ok := asMap(obj)
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range fields(v.Type()) {
+			if val, ok := m.Get(f.name); ok {
+				if err := fromObject(val, v.Field(f.index), path+"."+f.name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return mismatch()
+}
+
+// asMap returns the map obj is or, for a struct, its fields as one.
+func asMap(obj object.Object) (*object.Map, bool) {
+	switch obj := obj.(type) {
+	case *object.Map:
+		return obj, true
+	case *object.Struct:
+		m := object.NewMap()
+		for i, field := range obj.StructType.Fields {
+			m.Set(field, obj.Values[i])
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// prefix introduces an error message with path, if there is one.
+func prefix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return strings.TrimPrefix(path, ".") + ": "
+}
+
+// naturalValue converts obj to the Go value an `any` target gets.
+func naturalValue(obj object.Object) any {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil
+	case *object.Boolean:
+		return obj.Value
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Array:
+		elements := make([]any, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = naturalValue(el)
+		}
+		return elements
+	case *object.Map, *object.Struct:
+		fields, _ := asMap(obj)
+		m := make(map[string]any, fields.Len())
+		for _, key := range fields.Keys() {
+			el, _ := fields.Get(key)
+			m[key] = naturalValue(el)
+		}
+		return m
+	}
+	return obj
+}
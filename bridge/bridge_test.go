@@ -0,0 +1,218 @@
+package bridge
+
+import (
+	"errors"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X      int     `monkey:"x"`
+	Y      int     `monkey:"y"`
+	Label  string  `monkey:"label,omitempty"`
+	Secret string  `monkey:"-"`
+	Weight float64 // untagged
+	hidden bool
+}
+
+type route struct {
+	Name    string
+	Points  []point
+	Start   time.Time
+	Timeout time.Duration
+	Next    *route
+	Meta    map[string]any
+}
+
+func TestToObject(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{float32(1), "1.0"},
+		{"text", "text"},
+		{true, "true"},
+		{[]byte("raw"), "raw"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]int(nil), "null"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{map[int]bool{10: true, 9: false}, "{10: true, 9: false}"},
+		{point{X: 1, Y: 2, Secret: "s", hidden: true}, "{x: 1, y: 2, Weight: 0.0}"},
+		{&point{X: 1, Label: "home"}, "{x: 1, y: 0, label: home, Weight: 0.0}"},
+		{(*point)(nil), "null"},
+		{route{Name: "r", Points: []point{{X: 1}}, Start: start, Timeout: 90 * time.Second, Meta: map[string]any{"k": []any{1, "v"}}},
+			"{Name: r, Points: [{x: 1, y: 0, Weight: 0.0}], Start: 2024-03-01T12:30:00Z, Timeout: 1m30s, Next: null, Meta: {k: [1, v]}}"},
+		{&object.Integer{Value: 5}, "5"},
+		{[]object.Object{evaluator.TRUE}, "[true]"},
+		{make(chan int), "ERROR: bridge: cannot convert chan int"},
+		{uint64(1 << 63), "ERROR: bridge: 9223372036854775808 overflows INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if got := ToObject(tt.value).Inspect(); got != tt.expected {
+			t.Errorf("ToObject(%#v): expected=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+
+	if ToObject(true) != evaluator.TRUE || ToObject(nil) != evaluator.NULL {
+		t.Errorf("booleans and null should convert to the evaluator's singletons")
+	}
+	loop := &route{Name: "loop"}
+	loop.Next = loop
+	list := []any{1, nil}
+	list[1] = list
+	m := map[string]any{}
+	m["self"] = m
+	shared := &point{X: 1}
+	cycles := []struct {
+		value    any
+		expected string
+	}{
+		{loop, "ERROR: bridge: encountered a cycle via *bridge.route (field Next)"},
+		{list, "ERROR: bridge: encountered a cycle via []interface {}"},
+		{m, "ERROR: bridge: encountered a cycle via map[string]interface {}"},
+		{[]*point{shared, shared}, "[{x: 1, y: 0, Weight: 0.0}, {x: 1, y: 0, Weight: 0.0}]"},
+	}
+	for _, tt := range cycles {
+		if got := ToObject(tt.value).Inspect(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	original := route{
+		Name:    "r",
+		Points:  []point{{X: 1, Y: 2, Label: "a"}, {X: 3, Weight: 0.5}},
+		Start:   start,
+		Timeout: time.Minute,
+		Next:    &route{Name: "next"},
+		Meta:    map[string]any{"n": int64(1), "f": 1.5, "list": []any{"x", nil, true}},
+	}
+
+	var got route
+	if err := FromObject(ToObject(original), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, original) {
+		t.Errorf("round trip gave %+v, want %+v", got, original)
+	}
+
+	var anything any
+	if err := FromObject(ToObject(map[string][]int{"a": {1}}), &anything); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"a": []any{int64(1)}}; !reflect.DeepEqual(anything, want) {
+		t.Errorf("got %#v, want %#v", anything, want)
+	}
+
+	pointType := &object.StructType{Name: "Point", Fields: []string{"x", "y"}}
+	monkeyPoint := &object.Struct{StructType: pointType, Values: []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}}}
+	var p point
+	if err := FromObject(monkeyPoint, &p); err != nil || p != (point{X: 1, Y: 2}) {
+		t.Errorf("got %+v, %v, want the struct's fields", p, err)
+	}
+	if err := FromObject(monkeyPoint, &anything); err != nil || !reflect.DeepEqual(anything, map[string]any{"x": int64(1), "y": int64(2)}) {
+		t.Errorf("got %#v, %v, want a map of the struct's fields", anything, err)
+	}
+
+	anything = "set"
+	if err := FromObject(nil, &anything); err != nil || anything != nil {
+		t.Errorf("got %#v, %v, want nil for a nil object", anything, err)
+	}
+	next := &route{}
+	if err := FromObject(evaluator.Eval(parser.New(lexer.New("let x = 1;")).ParseProgram(), object.NewEnvironment()), &next); err != nil || next != nil {
+		t.Errorf("got %v, %v, want a nil pointer for the result of a let", next, err)
+	}
+
+	var obj object.Object
+	if err := FromObject(evaluator.TRUE, &obj); err != nil || obj != evaluator.TRUE {
+		t.Errorf("got %v, %v, want the object itself", obj, err)
+	}
+	var fn *object.Function
+	if err := FromObject(&object.Function{Name: "f"}, &fn); err != nil || fn.Name != "f" {
+		t.Errorf("got %v, %v, want the function itself", fn, err)
+	}
+
+	errorTests := []struct {
+		obj      object.Object
+		target   any
+		expected string
+	}{
+		{&object.String{Value: "x"}, new(int), "bridge: cannot convert STRING to int"},
+		{&object.Integer{Value: 300}, new(uint8), "bridge: 300 overflows uint8"},
+		{&object.Integer{Value: -1}, new(uint), "bridge: -1 overflows uint"},
+		{ToObject([]any{1, "two"}), new([]int), "bridge: [1]: cannot convert STRING to int"},
+		{ToObject(map[string]any{"Points": []any{map[string]any{"x": "1"}}}), new(route), "bridge: Points[0].x: cannot convert STRING to int"},
+		{ToObject([]int{1}), new([2]int), "bridge: cannot convert 1 elements to [2]int"},
+		{&object.String{Value: "soon"}, new(time.Time), `bridge: parsing time "soon"`},
+		{evaluator.NULL, point{}, "bridge: FromObject needs a non-nil pointer, got bridge.point"},
+		{nil, new(int), "bridge: cannot convert NULL to int"},
+	}
+	for _, tt := range errorTests {
+		err := FromObject(tt.obj, tt.target)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("FromObject(%s, %T): got error %v, want %q", tt.obj.Inspect(), tt.target, err, tt.expected)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("add", ToObject(func(a, b int) int { return a + b }))
+	env.Set("sum", ToObject(func(xs ...float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}))
+	env.Set("lookup", ToObject(func(p point) (string, error) {
+		if p.Label == "" {
+			return "", errors.New("no label")
+		}
+		return p.Label, nil
+	}))
+	env.Set("origin", ToObject(func() point { return point{Label: "origin"} }))
+	env.Set("divmod", ToObject(func(a, b int) (int, int) { return a / b, a % b }))
+	env.Set("touch", ToObject(func(string) {}))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"add(2, 3)", "5"},
+		{"sum()", "0.0"},
+		{"sum(1, 2)", "3.0"},
+		{"lookup(origin())", "origin"},
+		{`origin()["Weight"]`, "0.0"},
+		{"divmod(7, 2)", "[3, 1]"},
+		{`touch("x")`, "null"},
+		{"lookup(json_parse(json_stringify(origin())))", "origin"},
+		{`lookup(json_parse("{}"))`, "ERROR: no label"},
+		{"add(1)", "ERROR: wrong number of arguments. got=1, want=2"},
+		{`add(1, "2")`, "ERROR: bridge: argument 2: cannot convert STRING to int"},
+		{"divmod(1, 0)", "ERROR: go function panicked: runtime error: integer divide by zero"},
+		{"map([1, 2], fn(x) { add(x, x) })", "[2, 4]"},
+	}
+
+	for _, tt := range tests {
+		result := evaluator.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package bridge
+
+import (
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"reflect"
+)
+
+// wrapFunc makes a builtin of a Go function. Arguments are converted with
+// FromObject to the function's parameter types. Its results, less a final
+// error, convert to null, the one result, or an array of several. A non-nil
+// error becomes an *object.Error, as does a panic.
+func wrapFunc(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+	return &object.Builtin{
+		Fn: func(env *object.Environment, args ...object.Object) (result object.Object) {
+			defer func() {
+				if r := recover(); r != nil {
+					result = &object.Error{Message: fmt.Sprintf("go function panicked: %v", r)}
+				}
+			}()
+
+			in, err := arguments(t, args)
+			if err != nil {
+				return &object.Error{Message: err.Error()}
+			}
+			return results(fn.Call(in))
+		},
+	}
+}
+
+func arguments(t reflect.Type, args []object.Object) ([]reflect.Value, error) {
+	want := t.NumIn()
+	switch {
+	case t.IsVariadic() && len(args) < want-1:
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want at least %d", len(args), want-1)
+	case !t.IsVariadic() && len(args) != want:
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if t.IsVariadic() && i >= want-1 {
+			paramType = t.In(want - 1).Elem()
+		} else {
+			paramType = t.In(i)
+		}
+		in[i] = reflect.New(paramType).Elem()
+		if err := fromObject(arg, in[i], fmt.Sprintf("argument %d", i+1)); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+func results(out []reflect.Value) object.Object {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err := out[n-1].Interface(); err != nil {
+			return &object.Error{Message: err.(error).Error()}
+		}
+		out = out[:n-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return evaluator.NULL
+	case 1:
+		return ToObject(out[0].Interface())
+	}
+	elements := make([]object.Object, len(out))
+	for i, v := range out {
+		elements[i] = ToObject(v.Interface())
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/compiled"
+	"monkey/optimizer"
+	"os"
+	"strings"
+)
+
+// buildFile compiles a script for `monkey run` and embedders to load
+// without parsing it, optimizing it first with -O.
+func buildFile(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	out := flags.String("o", "", "")
+	optimize := flags.Bool("O", false, "")
+
+	// The output flag conventionally follows the file, so parse again
+	// after taking it.
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+	path := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil || flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(path, ".mk") + ".mkc"
+	}
+
+	_, program, ok := readScript(path)
+	if !ok {
+		return 1
+	}
+	if *optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	if err := os.WriteFile(*out, compiled.Encode(program), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,561 @@
+package compiled
+
+import (
+	"encoding/binary"
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// Each node is written as its tag followed by its token and fields. Tags
+// and field order are part of the format: changing them requires a new
+// formatVersion.
+const (
+	tagNil byte = iota
+	tagProgram
+	tagLetStatement
+	tagReturnStatement
+	tagExpressionStatement
+	tagBlockStatement
+	tagPrefixExpression
+	tagInfixExpression
+	tagIfExpression
+	tagFunctionLiteral
+	tagCallExpression
+	tagArrayLiteral
+	tagIndexExpression
+	tagSliceExpression
+	tagStringLiteral
+	tagIntegerLiteral
+	tagIdentifier
+	tagBoolean
+	tagMatchExpression
+	tagWildcardPattern
+	tagLiteralPattern
+	tagArrayPattern
+	tagNamedType
+	tagArrayType
+	tagFunctionType
+	tagStructStatement
+	tagStructLiteral
+	tagMemberExpression
+)
+
+// encoder writes nodes, collecting the strings they use in a constant pool
+// so that each name and literal is stored once.
+type encoder struct {
+	buf   []byte
+	pool  []string
+	index map[string]int
+}
+
+func newEncoder() *encoder {
+	return &encoder{index: map[string]int{}}
+}
+
+func (e *encoder) uvarint(x uint64) {
+	e.buf = binary.AppendUvarint(e.buf, x)
+}
+
+func (e *encoder) varint(x int64) {
+	e.buf = binary.AppendVarint(e.buf, x)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) str(s string) {
+	i, ok := e.index[s]
+	if !ok {
+		i = len(e.pool)
+		e.index[s] = i
+		e.pool = append(e.pool, s)
+	}
+	e.uvarint(uint64(i))
+}
+
+func (e *encoder) token(tok token.Token) {
+	e.str(string(tok.Type))
+	e.str(tok.Literal)
+	e.uvarint(uint64(tok.Line))
+	e.uvarint(uint64(tok.Column))
+}
+
+func (e *encoder) list(n int, node func(i int) ast.Node) {
+	e.uvarint(uint64(n))
+	for i := 0; i < n; i++ {
+		e.node(node(i))
+	}
+}
+
+func (e *encoder) node(node ast.Node) {
+	if isNil(node) {
+		e.buf = append(e.buf, tagNil)
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		e.buf = append(e.buf, tagProgram)
+		e.list(len(node.Statements), func(i int) ast.Node { return node.Statements[i] })
+	case *ast.LetStatement:
+		e.buf = append(e.buf, tagLetStatement)
+		e.token(node.Token)
+		e.node(node.Name)
+		e.node(node.Pattern)
+		e.node(node.Type)
+		e.node(node.Value)
+	case *ast.ReturnStatement:
+		e.buf = append(e.buf, tagReturnStatement)
+		e.token(node.Token)
+		e.node(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		e.buf = append(e.buf, tagExpressionStatement)
+		e.token(node.Token)
+		e.node(node.Expression)
+	case *ast.BlockStatement:
+		e.buf = append(e.buf, tagBlockStatement)
+		e.token(node.Token)
+		e.list(len(node.Statements), func(i int) ast.Node { return node.Statements[i] })
+	case *ast.PrefixExpression:
+		e.buf = append(e.buf, tagPrefixExpression)
+		e.token(node.Token)
+		e.str(node.Operator)
+		e.node(node.Right)
+	case *ast.InfixExpression:
+		e.buf = append(e.buf, tagInfixExpression)
+		e.token(node.Token)
+		e.str(node.Operator)
+		e.node(node.Left)
+		e.node(node.Right)
+	case *ast.IfExpression:
+		e.buf = append(e.buf, tagIfExpression)
+		e.token(node.Token)
+		e.node(node.Condition)
+		e.node(node.Consequence)
+		e.node(node.Alternative)
+	case *ast.FunctionLiteral:
+		e.buf = append(e.buf, tagFunctionLiteral)
+		e.token(node.Token)
+		e.list(len(node.Parameters), func(i int) ast.Node { return node.Parameters[i] })
+		e.list(len(node.ParameterPatterns), func(i int) ast.Node { return node.ParameterPatterns[i] })
+		e.list(len(node.ParameterTypes), func(i int) ast.Node { return node.ParameterTypes[i] })
+		e.node(node.ReturnType)
+		e.node(node.Body)
+	case *ast.CallExpression:
+		e.buf = append(e.buf, tagCallExpression)
+		e.token(node.Token)
+		e.node(node.Function)
+		e.list(len(node.Arguments), func(i int) ast.Node { return node.Arguments[i] })
+	case *ast.StructStatement:
+		e.buf = append(e.buf, tagStructStatement)
+		e.token(node.Token)
+		e.node(node.Name)
+		e.list(len(node.Fields), func(i int) ast.Node { return node.Fields[i] })
+	case *ast.StructLiteral:
+		e.buf = append(e.buf, tagStructLiteral)
+		e.token(node.Token)
+		e.node(node.Struct)
+		e.uvarint(uint64(len(node.Fields)))
+		for i, f := range node.Fields {
+			e.node(f)
+			e.node(node.Values[i])
+		}
+	case *ast.MemberExpression:
+		e.buf = append(e.buf, tagMemberExpression)
+		e.token(node.Token)
+		e.node(node.Object)
+		e.node(node.Member)
+	case *ast.ArrayLiteral:
+		e.buf = append(e.buf, tagArrayLiteral)
+		e.token(node.Token)
+		e.list(len(node.Elements), func(i int) ast.Node { return node.Elements[i] })
+	case *ast.IndexExpression:
+		e.buf = append(e.buf, tagIndexExpression)
+		e.token(node.Token)
+		e.node(node.Left)
+		e.node(node.Index)
+	case *ast.SliceExpression:
+		e.buf = append(e.buf, tagSliceExpression)
+		e.token(node.Token)
+		e.node(node.Left)
+		e.node(node.Start)
+		e.node(node.End)
+		e.node(node.Step)
+	case *ast.StringLiteral:
+		e.buf = append(e.buf, tagStringLiteral)
+		e.token(node.Token)
+		e.str(node.Value)
+	case *ast.IntegerLiteral:
+		e.buf = append(e.buf, tagIntegerLiteral)
+		e.token(node.Token)
+		e.varint(node.Value)
+	case *ast.Identifier:
+		e.buf = append(e.buf, tagIdentifier)
+		e.token(node.Token)
+		e.str(node.Value)
+	case *ast.Boolean:
+		e.buf = append(e.buf, tagBoolean)
+		e.token(node.Token)
+		e.bool(node.Value)
+	case *ast.MatchExpression:
+		e.buf = append(e.buf, tagMatchExpression)
+		e.token(node.Token)
+		e.node(node.Subject)
+		e.uvarint(uint64(len(node.Arms)))
+		for _, arm := range node.Arms {
+			e.node(arm.Pattern)
+			e.node(arm.Guard)
+			e.node(arm.Body)
+		}
+	case *ast.WildcardPattern:
+		e.buf = append(e.buf, tagWildcardPattern)
+		e.token(node.Token)
+	case *ast.LiteralPattern:
+		e.buf = append(e.buf, tagLiteralPattern)
+		e.token(node.Token)
+		e.node(node.Value)
+	case *ast.ArrayPattern:
+		e.buf = append(e.buf, tagArrayPattern)
+		e.token(node.Token)
+		e.list(len(node.Elements), func(i int) ast.Node { return node.Elements[i] })
+		e.node(node.Rest)
+	case *ast.NamedType:
+		e.buf = append(e.buf, tagNamedType)
+		e.token(node.Token)
+		e.str(node.Name)
+	case *ast.ArrayType:
+		e.buf = append(e.buf, tagArrayType)
+		e.token(node.Token)
+		e.node(node.Element)
+	case *ast.FunctionType:
+		e.buf = append(e.buf, tagFunctionType)
+		e.token(node.Token)
+		e.list(len(node.Parameters), func(i int) ast.Node { return node.Parameters[i] })
+		e.node(node.Return)
+	default:
+		panic(fmt.Sprintf("compiled: cannot encode %T", node))
+	}
+}
+
+// decoder reads nodes back, remembering the first error so the per-type
+// code can read fields without checking each one. After an error every
+// read returns a zero value.
+type decoder struct {
+	buf  []byte
+	pool []string
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("compiled: "+format, a...)
+	}
+}
+
+// finish returns the first error, or an error if data is left over.
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.fail("%d bytes after the end", len(d.buf))
+	}
+	return d.err
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.fail("truncated program")
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("truncated program")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail("truncated program")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+// count reads a list length, which cannot exceed the bytes left since
+// every element takes at least one.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail("truncated program")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) str() string {
+	i := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if i >= uint64(len(d.pool)) {
+		d.fail("constant %d out of range", i)
+		return ""
+	}
+	return d.pool[i]
+}
+
+func (d *decoder) token() token.Token {
+	return token.Token{
+		Type:    token.TokenType(d.str()),
+		Literal: d.str(),
+		Line:    int(d.uvarint()),
+		Column:  int(d.uvarint()),
+	}
+}
+
+func (d *decoder) node() ast.Node {
+	tag := d.byte()
+	if d.err != nil || tag == tagNil {
+		return nil
+	}
+
+	switch tag {
+	case tagProgram:
+		program := &ast.Program{Statements: []ast.Statement{}}
+		for n := d.count(); n > 0; n-- {
+			program.Statements = append(program.Statements, d.statement())
+		}
+		return program
+	case tagLetStatement:
+		return &ast.LetStatement{
+			Token:   d.token(),
+			Name:    d.identifier(),
+			Pattern: d.arrayPattern(),
+			Type:    d.typeExpression(),
+			Value:   d.expression(),
+		}
+	case tagReturnStatement:
+		return &ast.ReturnStatement{Token: d.token(), ReturnValue: d.expression()}
+	case tagExpressionStatement:
+		return &ast.ExpressionStatement{Token: d.token(), Expression: d.expression()}
+	case tagBlockStatement:
+		block := &ast.BlockStatement{Token: d.token(), Statements: []ast.Statement{}}
+		for n := d.count(); n > 0; n-- {
+			block.Statements = append(block.Statements, d.statement())
+		}
+		return block
+	case tagPrefixExpression:
+		return &ast.PrefixExpression{Token: d.token(), Operator: d.str(), Right: d.expression()}
+	case tagInfixExpression:
+		return &ast.InfixExpression{Token: d.token(), Operator: d.str(), Left: d.expression(), Right: d.expression()}
+	case tagIfExpression:
+		return &ast.IfExpression{
+			Token:       d.token(),
+			Condition:   d.expression(),
+			Consequence: d.block(),
+			Alternative: d.block(),
+		}
+	case tagFunctionLiteral:
+		fn := &ast.FunctionLiteral{Token: d.token(), Parameters: []*ast.Identifier{}}
+		for n := d.count(); n > 0; n-- {
+			fn.Parameters = append(fn.Parameters, d.identifier())
+		}
+		for n := d.count(); n > 0; n-- {
+			fn.ParameterPatterns = append(fn.ParameterPatterns, d.arrayPattern())
+		}
+		for n := d.count(); n > 0; n-- {
+			fn.ParameterTypes = append(fn.ParameterTypes, d.typeExpression())
+		}
+		fn.ReturnType = d.typeExpression()
+		fn.Body = d.block()
+		return fn
+	case tagCallExpression:
+		call := &ast.CallExpression{Token: d.token(), Function: d.expression(), Arguments: []ast.Expression{}}
+		for n := d.count(); n > 0; n-- {
+			call.Arguments = append(call.Arguments, d.expression())
+		}
+		return call
+	case tagStructStatement:
+		stmt := &ast.StructStatement{Token: d.token(), Name: d.identifier(), Fields: []*ast.Identifier{}}
+		for n := d.count(); n > 0; n-- {
+			stmt.Fields = append(stmt.Fields, d.identifier())
+		}
+		return stmt
+	case tagStructLiteral:
+		literal := &ast.StructLiteral{Token: d.token(), Struct: d.expression(), Fields: []*ast.Identifier{}, Values: []ast.Expression{}}
+		for n := d.count(); n > 0; n-- {
+			literal.Fields = append(literal.Fields, d.identifier())
+			literal.Values = append(literal.Values, d.expression())
+		}
+		return literal
+	case tagMemberExpression:
+		return &ast.MemberExpression{Token: d.token(), Object: d.expression(), Member: d.identifier()}
+	case tagArrayLiteral:
+		array := &ast.ArrayLiteral{Token: d.token(), Elements: []ast.Expression{}}
+		for n := d.count(); n > 0; n-- {
+			array.Elements = append(array.Elements, d.expression())
+		}
+		return array
+	case tagIndexExpression:
+		return &ast.IndexExpression{Token: d.token(), Left: d.expression(), Index: d.expression()}
+	case tagSliceExpression:
+		return &ast.SliceExpression{
+			Token: d.token(),
+			Left:  d.expression(),
+			Start: d.expression(),
+			End:   d.expression(),
+			Step:  d.expression(),
+		}
+	case tagStringLiteral:
+		return &ast.StringLiteral{Token: d.token(), Value: d.str()}
+	case tagIntegerLiteral:
+		return &ast.IntegerLiteral{Token: d.token(), Value: d.varint()}
+	case tagIdentifier:
+		return &ast.Identifier{Token: d.token(), Value: d.str()}
+	case tagBoolean:
+		return &ast.Boolean{Token: d.token(), Value: d.byte() != 0}
+	case tagMatchExpression:
+		match := &ast.MatchExpression{Token: d.token(), Subject: d.expression()}
+		for n := d.count(); n > 0; n-- {
+			match.Arms = append(match.Arms, &ast.MatchArm{
+				Pattern: d.pattern(),
+				Guard:   d.expression(),
+				Body:    d.expression(),
+			})
+		}
+		return match
+	case tagWildcardPattern:
+		return &ast.WildcardPattern{Token: d.token()}
+	case tagLiteralPattern:
+		return &ast.LiteralPattern{Token: d.token(), Value: d.expression()}
+	case tagArrayPattern:
+		pattern := &ast.ArrayPattern{Token: d.token(), Elements: []ast.Pattern{}}
+		for n := d.count(); n > 0; n-- {
+			pattern.Elements = append(pattern.Elements, d.pattern())
+		}
+		pattern.Rest = d.identifier()
+		return pattern
+	case tagNamedType:
+		return &ast.NamedType{Token: d.token(), Name: d.str()}
+	case tagArrayType:
+		return &ast.ArrayType{Token: d.token(), Element: d.typeExpression()}
+	case tagFunctionType:
+		fnType := &ast.FunctionType{Token: d.token()}
+		for n := d.count(); n > 0; n-- {
+			fnType.Parameters = append(fnType.Parameters, d.typeExpression())
+		}
+		fnType.Return = d.typeExpression()
+		return fnType
+	}
+
+	d.fail("unknown node tag %d", tag)
+	return nil
+}
+
+func (d *decoder) statement() ast.Statement {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		d.fail("expected statement, got %T", node)
+	}
+	return stmt
+}
+
+func (d *decoder) expression() ast.Expression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		d.fail("expected expression, got %T", node)
+	}
+	return exp
+}
+
+func (d *decoder) block() *ast.BlockStatement {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		d.fail("expected BlockStatement, got %T", node)
+	}
+	return block
+}
+
+func (d *decoder) identifier() *ast.Identifier {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	ident, ok := node.(*ast.Identifier)
+	if !ok {
+		d.fail("expected Identifier, got %T", node)
+	}
+	return ident
+}
+
+func (d *decoder) pattern() ast.Pattern {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	pattern, ok := node.(ast.Pattern)
+	if !ok {
+		d.fail("expected pattern, got %T", node)
+	}
+	return pattern
+}
+
+func (d *decoder) arrayPattern() *ast.ArrayPattern {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	pattern, ok := node.(*ast.ArrayPattern)
+	if !ok {
+		d.fail("expected ArrayPattern, got %T", node)
+	}
+	return pattern
+}
+
+func (d *decoder) typeExpression() ast.TypeExpression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+	typ, ok := node.(ast.TypeExpression)
+	if !ok {
+		d.fail("expected type, got %T", node)
+	}
+	return typ
+}
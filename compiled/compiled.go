@@ -0,0 +1,159 @@
+// Package compiled stores parsed programs in a binary format, so they can
+// be run without lexing and parsing their source again. A compiled program
+// starts with a fixed header:
+//
+//	magic     4 bytes  "MKC\x00"
+//	version   uint16   formatVersion, big endian
+//	length    uint32   length of the payload, big endian
+//	checksum  uint32   CRC-32 (Castagnoli) of the payload, big endian
+//
+// The payload is a constant pool of the strings the program uses followed
+// by its syntax tree, whose nodes refer to the pool by index.
+//
+// Environments are saved in the same way by Snapshot, so that one built by
+// an expensive evaluation can be restored cheaply wherever it is needed.
+package compiled
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// formatVersion changes whenever the encoding of the payload does. Programs
+// compiled for another version have to be built again from source.
+const formatVersion = 2
+
+const headerSize = 14
+
+var magic = []byte("MKC\x00")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrVersion is returned, wrapped, when decoding a program compiled with a
+// different format version.
+var ErrVersion = errors.New("unsupported format version")
+
+// IsCompiled reports whether data starts like a compiled program.
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Encode compiles program into the binary format.
+func Encode(program *ast.Program) []byte {
+	e := newEncoder()
+	e.node(program)
+	return e.seal(magic)
+}
+
+// Decode loads a program compiled by Encode, checking that it was compiled
+// for this format version and has not been truncated or corrupted.
+func Decode(data []byte) (*ast.Program, error) {
+	d, err := open(data, magic, "compiled program")
+	if err != nil {
+		return nil, err
+	}
+
+	node := d.node()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	program, ok := node.(*ast.Program)
+	if !ok {
+		return nil, fmt.Errorf("compiled: expected Program, got %T", node)
+	}
+	return program, nil
+}
+
+// seal prefixes the constant pool to what e wrote and both with a header.
+func (e *encoder) seal(magic []byte) []byte {
+	pool := &encoder{}
+	pool.uvarint(uint64(len(e.pool)))
+	for _, s := range e.pool {
+		pool.uvarint(uint64(len(s)))
+		pool.buf = append(pool.buf, s...)
+	}
+	payload := append(pool.buf, e.buf...)
+
+	out := make([]byte, headerSize, headerSize+len(payload))
+	copy(out, magic)
+	binary.BigEndian.PutUint16(out[4:], formatVersion)
+	binary.BigEndian.PutUint32(out[6:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(out[10:], crc32.Checksum(payload, castagnoli))
+	return append(out, payload...)
+}
+
+// open checks the header of data written by seal and returns a decoder
+// for the rest, with the constant pool read. what names the kind of data
+// magic identifies.
+func open(data, magic []byte, what string) (*decoder, error) {
+	if !bytes.HasPrefix(data, magic) {
+		return nil, fmt.Errorf("compiled: not a %s", what)
+	}
+	if len(data) < headerSize {
+		return nil, errors.New("compiled: truncated header")
+	}
+	if version := binary.BigEndian.Uint16(data[4:]); version != formatVersion {
+		return nil, fmt.Errorf("compiled: %w %d, want %d", ErrVersion, version, formatVersion)
+	}
+	payload := data[headerSize:]
+	if length := binary.BigEndian.Uint32(data[6:]); uint64(length) != uint64(len(payload)) {
+		return nil, fmt.Errorf("compiled: payload is %d bytes, want %d", len(payload), length)
+	}
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(data[10:]) {
+		return nil, errors.New("compiled: checksum mismatch")
+	}
+
+	d := &decoder{buf: payload}
+	for n := d.count(); n > 0; n-- {
+		size := d.count()
+		if d.err != nil {
+			break
+		}
+		d.pool = append(d.pool, string(d.buf[:size]))
+		d.buf = d.buf[size:]
+	}
+	return d, d.err
+}
+
+// LoadFile loads the program in the file at path, which may be either
+// compiled or source. It is the way for applications embedding Monkey to
+// load scripts, whichever form they are shipped in.
+func LoadFile(path string) (*ast.Program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if IsCompiled(data) {
+		program, err := Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return program, nil
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+	return program, nil
+}
+
+// isNil reports whether node is absent, including typed nil pointers held
+// by an interface, as optional children are.
+func isNil(node ast.Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
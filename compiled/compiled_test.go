@@ -0,0 +1,296 @@
+package compiled
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %v", input, p.Errors())
+	}
+	return program
+}
+
+func eval(program *ast.Program) (string, string) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetOutput(&out)
+
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		return "<nil>", out.String()
+	}
+	return result.Inspect(), out.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"let x: int = 5 * (2 + -3); puts(x); x",
+		`let s = "héllo"; s + " " + s; s[1:3]; [1, 2, 3, 4][::2]; [1][0]`,
+		"let f: fn(int, bool): [int] = fn(a: int, b): [int] { return [a] }; f(1, !true)",
+		"let add = fn([a, ...b]: [int], c) { a + len(b) + c }; add([1, 2, 3], 4)",
+		"let [h, [i, _], ...t] = [1, [2, 3], 4]; h + i + len(t)",
+		`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)`,
+		`match ([1, 2]) { [] => 0, [-1, ..._] => 1, [h, ...t] if h > 0 => h + len(t), _ => "other" }`,
+		`if (false) { 1 }`,
+		`puts(missing)`,
+		"struct Point { x, y } let p = Point{x: 1, y: 2}; p{y: p.x + 1}.y",
+	}
+
+	for _, input := range tests {
+		program := parse(t, input)
+		data := Encode(program)
+		if !IsCompiled(data) {
+			t.Fatalf("%q: encoded program lacks the magic header", input)
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+
+		if got, want := string(ast.ToJSON(decoded)), string(ast.ToJSON(program)); got != want {
+			t.Errorf("%q: decoded tree differs:\ngot  %s\nwant %s", input, got, want)
+		}
+
+		gotResult, gotOut := eval(decoded)
+		wantResult, wantOut := eval(parse(t, input))
+		if gotResult != wantResult || gotOut != wantOut {
+			t.Errorf("%q: decoded program gives %s with output %q, want %s with output %q",
+				input, gotResult, gotOut, wantResult, wantOut)
+		}
+	}
+}
+
+func TestConstantPool(t *testing.T) {
+	literal := "a rather long string literal"
+	program := parse(t, strings.Repeat(`puts("`+literal+`");`, 100))
+
+	if n := len(Encode(program)); n > 100*len(literal) {
+		t.Errorf("100 statements encode to %d bytes: strings are not shared", n)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := Encode(parse(t, `let x = "value"; x`))
+
+	corrupt := func(modify func(data []byte) []byte) []byte {
+		return modify(append([]byte{}, data...))
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"source", []byte("let x = 1;"), "compiled: not a compiled program"},
+		{"header", data[:8], "compiled: truncated header"},
+		{"version", corrupt(func(d []byte) []byte {
+			binary.BigEndian.PutUint16(d[4:], formatVersion+1)
+			return d
+		}), "compiled: unsupported format version 3, want 2"},
+		{"length", data[:len(data)-1], "compiled: payload is"},
+		{"checksum", corrupt(func(d []byte) []byte {
+			d[len(d)-1] ^= 0xff
+			return d
+		}), "compiled: checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(tt.data)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.expected)
+		}
+	}
+
+	versioned := corrupt(func(d []byte) []byte {
+		binary.BigEndian.PutUint16(d[4:], 0)
+		return d
+	})
+	if _, err := Decode(versioned); !errors.Is(err, ErrVersion) {
+		t.Errorf("got error %v, want ErrVersion", err)
+	}
+}
+
+// A payload that is not a valid program but has a matching checksum must
+// still be rejected rather than crash the decoder.
+func TestDecodeMalformedPayload(t *testing.T) {
+	data := Encode(parse(t, `let x = [1, 2, 3]; x`))
+	for n := headerSize; n < len(data); n++ {
+		payload := data[headerSize:n]
+		_, err := Decode(withHeader(payload))
+		if err == nil {
+			t.Errorf("payload truncated to %d bytes decoded without error", len(payload))
+		}
+	}
+
+	if _, err := Decode(withHeader([]byte{1, 1, 'x', 200})); err == nil || !strings.Contains(err.Error(), "unknown node tag") {
+		t.Errorf("got error %v, want unknown node tag", err)
+	}
+}
+
+func withHeader(payload []byte) []byte {
+	data := make([]byte, headerSize)
+	copy(data, magic)
+	binary.BigEndian.PutUint16(data[4:], formatVersion)
+	binary.BigEndian.PutUint32(data[6:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[10:], crc32.Checksum(payload, castagnoli))
+	return append(data, payload...)
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "prog.mk")
+	binary := filepath.Join(dir, "prog.mkc")
+	input := "let sq = fn(x) { x * x }; sq(7)"
+	if err := os.WriteFile(source, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binary, Encode(parse(t, input)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{source, binary} {
+		program, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if result, _ := eval(program); result != "49" {
+			t.Errorf("%s: got %s, want 49", path, result)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.mk")
+	if err := os.WriteFile(bad, []byte("let = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(bad); err == nil || !strings.HasPrefix(err.Error(), bad+": ") {
+		t.Errorf("got error %v, want a parse error for %s", err, bad)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	library := `
+let table = [[1, "one"], [2, "two"], [3, "three"]];
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+let adder = fn(n) { fn(x) { x + n } };
+let add_two = adder(2);
+let add_three = adder(3);
+let shared = [true, false];
+let pair = [shared, shared];
+let say = puts;
+let nothing = if (false) { 1 };
+struct Point { x, y }
+let origin = Point(0, [shared]);
+`
+	base := object.NewEnvironment()
+	if result := evaluator.Eval(parse(t, library), base); result != nil && result.Type() == object.ERROR_OBJ {
+		t.Fatal(result.Inspect())
+	}
+	doc := object.NewMap()
+	doc.Set("price", &object.Float{Value: 2.5})
+	table, _ := base.Get("table")
+	doc.Set("table", table)
+	base.Set("doc", doc)
+	base.Freeze()
+
+	data, err := Snapshot(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Restore(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.Frozen() {
+		t.Errorf("restored environment is not frozen")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{"fact(10)", "3628800", ""},
+		{"add_two(1) + add_three(1)", "7", ""},
+		{"table[1][1]", "two", ""},
+		{"pair[0][0] == true", "true", ""},
+		{"nothing", "null", ""},
+		{`doc["price"] * 2`, "5.0", ""},
+		{`keys(doc)`, "[price, table]", ""},
+		{`say("hi")`, "null", "hi\n"},
+		{"origin{x: 1}", "Point{x: 1, y: [[true, false]]}", ""},
+		{"Point(1, 2).y", "2", ""},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		env := object.NewEnvironmentFrom(restored)
+		env.SetOutput(&out)
+		result := evaluator.Eval(parse(t, tt.input), env)
+		if result.Inspect() != tt.expected || out.String() != tt.output {
+			t.Errorf("%q: got %s with output %q, want %s with output %q",
+				tt.input, result.Inspect(), out.String(), tt.expected, tt.output)
+		}
+	}
+
+	get := func(name string) object.Object {
+		val, ok := restored.Get(name)
+		if !ok {
+			t.Fatalf("%s is not bound", name)
+		}
+		return val
+	}
+	pair := get("pair").(*object.Array)
+	if pair.Elements[0] != pair.Elements[1] || pair.Elements[0] != get("shared") {
+		t.Errorf("shared array was copied")
+	}
+	if table, _ := get("doc").(*object.Map).Get("table"); table != get("table") {
+		t.Errorf("array shared by a map was copied")
+	}
+	origin := get("origin").(*object.Struct)
+	if origin.StructType != get("Point") || origin.Values[1].(*object.Array).Elements[0] != get("shared") {
+		t.Errorf("struct type or array shared by a struct was copied")
+	}
+	fact := get("fact").(*object.Function)
+	if fact.Env != restored || fact.Name != "fact" || fact.Token.Line != 3 {
+		t.Errorf("fact was restored as %s in %p, want it closed over %p", fact.Label(), fact.Env, restored)
+	}
+	add_two, add_three := get("add_two").(*object.Function), get("add_three").(*object.Function)
+	if add_two.Body != add_three.Body || add_two.Env == add_three.Env || add_two.Env.Outer() != restored {
+		t.Errorf("closures of one literal should share code but not environments")
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	env := object.NewEnvironment()
+	evaluator.Eval(parse(t, "let f = fn() { let ch = channel(); fn() { ch } }; let g = f();"), env)
+	if _, err := Snapshot(env); err == nil || err.Error() != "compiled: cannot snapshot g: ch: CHANNEL value" {
+		t.Errorf("got error %v, want a CHANNEL value error", err)
+	}
+
+	data, err := Snapshot(object.NewEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(data[:len(data)-1]); err == nil {
+		t.Errorf("truncated snapshot restored without error")
+	}
+	if _, err := Restore(Encode(parse(t, "1"))); err == nil || err.Error() != "compiled: not a snapshot" {
+		t.Errorf("got error %v, want compiled: not a snapshot", err)
+	}
+}
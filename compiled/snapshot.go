@@ -0,0 +1,431 @@
+package compiled
+
+import (
+	"fmt"
+	"math"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// Snapshots share the header, constant pool and syntax tree encoding of
+// compiled programs but start with their own magic.
+var snapshotMagic = []byte("MKS\x00")
+
+// Value kinds in a snapshot. Like node tags they are part of the format.
+const (
+	kindNull byte = iota
+	kindTrue
+	kindFalse
+	kindInteger
+	kindString
+	kindArray
+	kindFunction
+	kindBuiltin
+	kindFloat
+	kindMap
+	kindStructType
+	kindStruct
+)
+
+// Snapshot serializes env together with everything reachable from it: the
+// environments it encloses, the values bound in them and, for functions,
+// their code and the environments they close over. Values referenced from
+// several places, including through cycles, are stored once and shared
+// again after Restore. Iterators, tasks and channels cannot be saved.
+//
+// A snapshot records bindings, not evaluation settings: restored
+// environments write to no output and read no input until told otherwise.
+func Snapshot(env *object.Environment) ([]byte, error) {
+	s := &snapshotter{
+		envIDs:  map[*object.Environment]int{},
+		objIDs:  map[object.Object]int{},
+		bodyIDs: map[*ast.BlockStatement]int{},
+	}
+	if err := s.env(env); err != nil {
+		return nil, fmt.Errorf("compiled: cannot snapshot %w", err)
+	}
+
+	e := newEncoder()
+	e.uvarint(uint64(len(s.envs)))
+	for _, env := range s.envs {
+		outer := env.Outer()
+		e.uvarint(s.ref(outer))
+		e.bool(outer != nil && env.Context() != outer.Context())
+		e.bool(env.Frozen())
+	}
+
+	e.uvarint(uint64(len(s.objs)))
+	for _, obj := range s.objs {
+		s.encodeObject(e, obj)
+	}
+
+	for _, env := range s.envs {
+		names := env.Names()
+		e.uvarint(uint64(len(names)))
+		for _, name := range names {
+			val, _ := env.Get(name)
+			e.str(name)
+			e.uvarint(uint64(s.objIDs[val]))
+		}
+	}
+
+	e.uvarint(uint64(s.envIDs[env]))
+	return e.seal(snapshotMagic), nil
+}
+
+// snapshotter numbers the environments and values to save so that they can
+// refer to each other by number. An environment is numbered after the one
+// it encloses, so Restore can create them in order.
+type snapshotter struct {
+	envs    []*object.Environment
+	envIDs  map[*object.Environment]int
+	objs    []object.Object
+	objIDs  map[object.Object]int
+	bodyIDs map[*ast.BlockStatement]int
+}
+
+func (s *snapshotter) env(env *object.Environment) error {
+	if _, ok := s.envIDs[env]; ok {
+		return nil
+	}
+	if outer := env.Outer(); outer != nil {
+		if err := s.env(outer); err != nil {
+			return err
+		}
+		// Numbering outer may have reached env through a closure.
+		if _, ok := s.envIDs[env]; ok {
+			return nil
+		}
+	}
+	s.envIDs[env] = len(s.envs)
+	s.envs = append(s.envs, env)
+
+	for _, name := range env.Names() {
+		val, _ := env.Get(name)
+		if err := s.object(val); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *snapshotter) object(obj object.Object) error {
+	if _, ok := s.objIDs[obj]; ok {
+		return nil
+	}
+	switch obj := obj.(type) {
+	case *object.Null, *object.Boolean, *object.Integer, *object.Float, *object.String:
+	case *object.Builtin:
+		if builtin, ok := evaluator.LookupBuiltin(obj.Name); !ok || builtin != obj {
+			return fmt.Errorf("builtin %q", obj.Name)
+		}
+	case *object.Array, *object.Map, *object.Function, *object.StructType, *object.Struct:
+	default:
+		return fmt.Errorf("%s value", obj.Type())
+	}
+	s.objIDs[obj] = len(s.objs)
+	s.objs = append(s.objs, obj)
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		for _, el := range obj.Elements {
+			if err := s.object(el); err != nil {
+				return err
+			}
+		}
+	case *object.Map:
+		for _, key := range obj.Keys() {
+			val, _ := obj.Get(key)
+			if err := s.object(val); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	case *object.Struct:
+		if err := s.object(obj.StructType); err != nil {
+			return err
+		}
+		for i, val := range obj.Values {
+			if err := s.object(val); err != nil {
+				return fmt.Errorf("%s: %w", obj.StructType.Fields[i], err)
+			}
+		}
+	case *object.Function:
+		return s.env(obj.Env)
+	}
+	return nil
+}
+
+// ref numbers an optional environment, with 0 for none.
+func (s *snapshotter) ref(env *object.Environment) uint64 {
+	if env == nil {
+		return 0
+	}
+	return uint64(s.envIDs[env]) + 1
+}
+
+func (s *snapshotter) encodeObject(e *encoder, obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		e.buf = append(e.buf, kindNull)
+	case *object.Boolean:
+		if obj.Value {
+			e.buf = append(e.buf, kindTrue)
+		} else {
+			e.buf = append(e.buf, kindFalse)
+		}
+	case *object.Integer:
+		e.buf = append(e.buf, kindInteger)
+		e.varint(obj.Value)
+	case *object.Float:
+		e.buf = append(e.buf, kindFloat)
+		e.uvarint(math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf = append(e.buf, kindString)
+		e.str(obj.Value)
+	case *object.Map:
+		e.buf = append(e.buf, kindMap)
+		e.uvarint(uint64(obj.Len()))
+		for _, key := range obj.Keys() {
+			val, _ := obj.Get(key)
+			e.str(key)
+			e.uvarint(uint64(s.objIDs[val]))
+		}
+	case *object.Array:
+		e.buf = append(e.buf, kindArray)
+		e.uvarint(uint64(len(obj.Elements)))
+		for _, el := range obj.Elements {
+			e.uvarint(uint64(s.objIDs[el]))
+		}
+	case *object.StructType:
+		e.buf = append(e.buf, kindStructType)
+		e.str(obj.Name)
+		e.uvarint(uint64(len(obj.Fields)))
+		for _, f := range obj.Fields {
+			e.str(f)
+		}
+	case *object.Struct:
+		e.buf = append(e.buf, kindStruct)
+		e.uvarint(uint64(s.objIDs[obj.StructType]))
+		e.uvarint(uint64(len(obj.Values)))
+		for _, val := range obj.Values {
+			e.uvarint(uint64(s.objIDs[val]))
+		}
+	case *object.Builtin:
+		e.buf = append(e.buf, kindBuiltin)
+		e.str(obj.Name)
+	case *object.Function:
+		e.buf = append(e.buf, kindFunction)
+		e.token(obj.Token)
+		e.str(obj.Name)
+		e.uvarint(uint64(s.envIDs[obj.Env]))
+
+		// Closures created by the same literal share its code, which is
+		// written with the first of them.
+		id, ok := s.bodyIDs[obj.Body]
+		if !ok {
+			id = len(s.bodyIDs)
+			s.bodyIDs[obj.Body] = id
+		}
+		e.uvarint(uint64(id))
+		if !ok {
+			e.list(len(obj.Parameters), func(i int) ast.Node { return obj.Parameters[i] })
+			e.list(len(obj.ParameterPatterns), func(i int) ast.Node { return obj.ParameterPatterns[i] })
+			e.node(obj.Body)
+		}
+	}
+}
+
+// Restore recreates the environment saved by Snapshot.
+func Restore(data []byte) (*object.Environment, error) {
+	d, err := open(data, snapshotMagic, "snapshot")
+	if err != nil {
+		return nil, err
+	}
+
+	envs := make([]*object.Environment, d.count())
+	frozen := make([]bool, len(envs))
+	for i := range envs {
+		outer := d.uvarint()
+		ownContext := d.byte() != 0
+		frozen[i] = d.byte() != 0
+		switch {
+		case d.err != nil:
+			return nil, d.err
+		case outer == 0:
+			envs[i] = object.NewEnvironment()
+		case outer > uint64(i):
+			return nil, fmt.Errorf("compiled: environment %d encloses a later one", i)
+		case ownContext:
+			envs[i] = object.NewEnvironmentFrom(envs[outer-1])
+		default:
+			envs[i] = object.NewEnclosedEnvironment(envs[outer-1])
+		}
+	}
+
+	env := func() *object.Environment {
+		i := d.uvarint()
+		if d.err == nil && i >= uint64(len(envs)) {
+			d.fail("environment %d out of range", i)
+		}
+		if d.err != nil {
+			return nil
+		}
+		return envs[i]
+	}
+
+	// Arrays, maps and structs can refer to values stored after them, so
+	// their elements are filled in once every value exists.
+	objs := make([]object.Object, d.count())
+	elements := map[*object.Array][]uint64{}
+	type entry struct {
+		key string
+		id  uint64
+	}
+	entries := map[*object.Map][]entry{}
+	type fields struct {
+		structType uint64
+		values     []uint64
+	}
+	structs := map[*object.Struct]fields{}
+	type code struct {
+		params   []*ast.Identifier
+		patterns []*ast.ArrayPattern
+		body     *ast.BlockStatement
+	}
+	codes := []code{}
+	for i := range objs {
+		switch kind := d.byte(); kind {
+		case kindNull:
+			objs[i] = evaluator.NULL
+		case kindTrue:
+			objs[i] = evaluator.TRUE
+		case kindFalse:
+			objs[i] = evaluator.FALSE
+		case kindInteger:
+			objs[i] = &object.Integer{Value: d.varint()}
+		case kindFloat:
+			objs[i] = &object.Float{Value: math.Float64frombits(d.uvarint())}
+		case kindString:
+			objs[i] = &object.String{Value: d.str()}
+		case kindMap:
+			m := object.NewMap()
+			for n := d.count(); n > 0; n-- {
+				entries[m] = append(entries[m], entry{key: d.str(), id: d.uvarint()})
+			}
+			objs[i] = m
+		case kindArray:
+			array := &object.Array{Elements: make([]object.Object, d.count())}
+			ids := make([]uint64, len(array.Elements))
+			for j := range ids {
+				ids[j] = d.uvarint()
+			}
+			elements[array] = ids
+			objs[i] = array
+		case kindStructType:
+			st := &object.StructType{Name: d.str(), Fields: []string{}}
+			for n := d.count(); n > 0; n-- {
+				st.Fields = append(st.Fields, d.str())
+			}
+			objs[i] = st
+		case kindStruct:
+			f := fields{structType: d.uvarint(), values: make([]uint64, d.count())}
+			for j := range f.values {
+				f.values[j] = d.uvarint()
+			}
+			st := &object.Struct{}
+			structs[st] = f
+			objs[i] = st
+		case kindBuiltin:
+			name := d.str()
+			builtin, ok := evaluator.LookupBuiltin(name)
+			if !ok && d.err == nil {
+				d.fail("unknown builtin %q", name)
+			}
+			objs[i] = builtin
+		case kindFunction:
+			fn := &object.Function{Token: d.token(), Name: d.str(), Env: env()}
+			id := d.uvarint()
+			if id == uint64(len(codes)) {
+				c := code{}
+				for n := d.count(); n > 0; n-- {
+					c.params = append(c.params, d.identifier())
+				}
+				for n := d.count(); n > 0; n-- {
+					c.patterns = append(c.patterns, d.arrayPattern())
+				}
+				c.body = d.block()
+				codes = append(codes, c)
+			} else if id > uint64(len(codes)) {
+				d.fail("function code %d out of range", id)
+			}
+			if d.err != nil {
+				return nil, d.err
+			}
+			fn.Parameters, fn.ParameterPatterns, fn.Body = codes[id].params, codes[id].patterns, codes[id].body
+			objs[i] = fn
+		default:
+			d.fail("unknown value kind %d", kind)
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+	}
+
+	obj := func(id uint64) object.Object {
+		if d.err == nil && id >= uint64(len(objs)) {
+			d.fail("value %d out of range", id)
+		}
+		if d.err != nil {
+			return nil
+		}
+		return objs[id]
+	}
+	for array, ids := range elements {
+		for j, id := range ids {
+			array.Elements[j] = obj(id)
+		}
+	}
+	for m, entries := range entries {
+		for _, entry := range entries {
+			if val := obj(entry.id); val != nil {
+				m.Set(entry.key, val)
+			}
+		}
+	}
+
+	for st, f := range structs {
+		structType, ok := obj(f.structType).(*object.StructType)
+		if d.err != nil {
+			return nil, d.err
+		}
+		if !ok || len(f.values) != len(structType.Fields) {
+			return nil, fmt.Errorf("compiled: value %d is not a struct type with %d fields", f.structType, len(f.values))
+		}
+		st.StructType = structType
+		st.Values = make([]object.Object, len(f.values))
+		for j, id := range f.values {
+			st.Values[j] = obj(id)
+		}
+	}
+
+	for _, e := range envs {
+		for n := d.count(); n > 0; n-- {
+			name := d.str()
+			if val := obj(d.uvarint()); val != nil {
+				e.Set(name, val)
+			}
+		}
+	}
+	root := env()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+
+	for i, e := range envs {
+		if frozen[i] {
+			e.Freeze()
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/coverage"
+	"monkey/object"
+	"os"
+)
+
+// coverFile runs a script like runFile, then prints its coverage to stderr
+// and writes the profiles asked for with --coverprofile and --html.
+func coverFile(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	profilePath := flags.String("coverprofile", "", "")
+	htmlPath := flags.String("html", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+	path := flags.Arg(0)
+
+	source, program, ok := readScript(path)
+	if !ok {
+		return 1
+	}
+
+	env := object.NewEnvironment()
+	env.SetOutput(os.Stdout)
+	env.SetInput(os.Stdin)
+
+	cov := coverage.New(path, source, program)
+	status := 0
+	if errObj, ok := cov.Run(env).(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, errObj.Message)
+		status = 1
+	}
+	fmt.Fprintln(os.Stderr, cov.Summary())
+
+	if *profilePath != "" {
+		if err := writeFile(*profilePath, func(w io.Writer) error {
+			cov.WriteProfile(w)
+			return nil
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *htmlPath != "" {
+		if err := writeFile(*htmlPath, cov.WriteHTML); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return status
+}
+
+// writeFile creates path and fills it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
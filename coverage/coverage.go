@@ -0,0 +1,271 @@
+// Package coverage records which statements of a Monkey program run and
+// which way its if expressions go, and reports it in a text format modelled
+// on `go test -coverprofile` or as an annotated HTML page.
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/token"
+	"reflect"
+	"sort"
+)
+
+// Block is a statement or a branch of an if expression and how often it
+// ran. Positions are 1-based and End is just past the block's last
+// character. A missing else branch is an empty block at the end of its if
+// expression.
+type Block struct {
+	StartLine, StartColumn int
+	EndLine, EndColumn     int
+	Statements             int // 1 for a statement, 0 for a branch
+	Count                  int
+}
+
+// Coverage is an object.BranchTracer that records the coverage of one
+// program. Spawned tasks are not traced, so statements only they run are
+// reported as never run.
+type Coverage struct {
+	filename string
+	source   string
+	program  *ast.Program
+
+	blocks     []*Block
+	statements map[ast.Statement]*Block
+	branches   map[*ast.IfExpression][2]*Block
+}
+
+// New prepares to record the coverage of program, parsed from source read
+// from filename.
+func New(filename, source string, program *ast.Program) *Coverage {
+	c := &Coverage{
+		filename:   filename,
+		source:     source,
+		program:    program,
+		statements: map[ast.Statement]*Block{},
+		branches:   map[*ast.IfExpression][2]*Block{},
+	}
+
+	spans := newSpanner(source)
+	ast.Walk(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case ast.Statement:
+			c.statements[node] = c.addBlock(spans.span(node), 1)
+		case *ast.IfExpression:
+			consequence := c.addBlock(spans.span(node.Consequence), 0)
+			var alternative *Block
+			if node.Alternative != nil {
+				alternative = c.addBlock(spans.span(node.Alternative), 0)
+			} else {
+				end := spans.span(node)
+				alternative = c.addBlock(Block{
+					StartLine: end.EndLine, StartColumn: end.EndColumn,
+					EndLine: end.EndLine, EndColumn: end.EndColumn,
+				}, 0)
+			}
+			c.branches[node] = [2]*Block{consequence, alternative}
+		}
+		return true
+	})
+
+	sort.SliceStable(c.blocks, func(i, j int) bool {
+		a, b := c.blocks[i], c.blocks[j]
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.StartColumn < b.StartColumn
+	})
+	return c
+}
+
+func (c *Coverage) addBlock(span Block, statements int) *Block {
+	block := &span
+	block.Statements = statements
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+// Run evaluates the program in env while recording its coverage and
+// returns its result.
+func (c *Coverage) Run(env *object.Environment) object.Object {
+	defer env.SetTracer(env.Context().Tracer)
+	env.SetTracer(c)
+	return evaluator.Eval(c.program, env)
+}
+
+func (c *Coverage) Statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	if block, ok := c.statements[stmt]; ok {
+		block.Count++
+	}
+	return nil
+}
+
+func (c *Coverage) Branch(expr *ast.IfExpression, consequence bool) {
+	branches, ok := c.branches[expr]
+	if !ok {
+		return
+	}
+	if consequence {
+		branches[0].Count++
+	} else {
+		branches[1].Count++
+	}
+}
+
+func (c *Coverage) Call(fn object.Object, env *object.Environment) {}
+func (c *Coverage) Return(fn object.Object, result object.Object)  {}
+
+// Blocks returns the statements and branches in source order.
+func (c *Coverage) Blocks() []Block {
+	blocks := make([]Block, len(c.blocks))
+	for i, block := range c.blocks {
+		blocks[i] = *block
+	}
+	return blocks
+}
+
+// Statements counts the statements that ran at least once.
+func (c *Coverage) Statements() (covered, total int) {
+	for _, block := range c.statements {
+		total++
+		if block.Count > 0 {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+// Branches counts the branches of if expressions taken at least once.
+func (c *Coverage) Branches() (covered, total int) {
+	for _, branches := range c.branches {
+		for _, block := range branches {
+			total++
+			if block.Count > 0 {
+				covered++
+			}
+		}
+	}
+	return covered, total
+}
+
+// Summary describes the coverage in one line, e.g.
+// "coverage: 75.0% of statements, 3/4 branches".
+func (c *Coverage) Summary() string {
+	covered, total := c.Statements()
+	percent := 0.0
+	if total > 0 {
+		percent = 100 * float64(covered) / float64(total)
+	}
+	coveredBranches, branches := c.Branches()
+	return fmt.Sprintf("coverage: %.1f%% of statements, %d/%d branches", percent, coveredBranches, branches)
+}
+
+// WriteProfile writes the blocks in a format modelled on count mode of
+// `go test -coverprofile`. It is only Go-cover-like: columns count runes
+// rather than bytes, and `go tool cover` cannot read it, as it resolves
+// file names to Go packages. Branches are blocks of no statements.
+func (c *Coverage) WriteProfile(out io.Writer) {
+	fmt.Fprintln(out, "mode: count")
+	for _, block := range c.blocks {
+		fmt.Fprintf(out, "%s:%d.%d,%d.%d %d %d\n", c.filename,
+			block.StartLine, block.StartColumn, block.EndLine, block.EndColumn,
+			block.Statements, block.Count)
+	}
+}
+
+// spanner finds the extent of nodes in their source. Nodes only record
+// their first token, so a node extends to the last token of its
+// descendants and any brackets that close after it.
+type spanner struct {
+	tokens []token.Token
+	index  map[[2]int]int
+}
+
+func newSpanner(source string) *spanner {
+	s := &spanner{tokens: lexer.Tokenize(source), index: map[[2]int]int{}}
+	for i, tok := range s.tokens {
+		s.index[[2]int{tok.Line, tok.Column}] = i
+	}
+	return s
+}
+
+func (s *spanner) span(node ast.Node) Block {
+	first, last := -1, -1
+	ast.Walk(node, func(n ast.Node) bool {
+		tok, ok := nodeToken(n)
+		if !ok {
+			return true
+		}
+		if i, ok := s.index[[2]int{tok.Line, tok.Column}]; ok {
+			if first == -1 || i < first {
+				first = i
+			}
+			if i > last {
+				last = i
+			}
+		}
+		return true
+	})
+	if first == -1 {
+		return Block{}
+	}
+
+	depth := 0
+	for _, tok := range s.tokens[first : last+1] {
+		depth += bracketDepth(tok)
+	}
+	for depth > 0 && last+1 < len(s.tokens) && bracketDepth(s.tokens[last+1]) < 0 {
+		last++
+		depth--
+	}
+
+	start, end := s.tokens[first], s.tokens[last]
+	endLine, endColumn := tokenEnd(end)
+	return Block{StartLine: start.Line, StartColumn: start.Column, EndLine: endLine, EndColumn: endColumn}
+}
+
+func bracketDepth(tok token.Token) int {
+	switch tok.Type {
+	case token.LPAREN, token.LBRACE, token.LBRACKET:
+		return 1
+	case token.RPAREN, token.RBRACE, token.RBRACKET:
+		return -1
+	}
+	return 0
+}
+
+// tokenEnd returns the position just past tok in its source.
+func tokenEnd(tok token.Token) (line, column int) {
+	text := tok.Literal
+	if tok.Type == token.STRING {
+		text = `"` + text + `"`
+	}
+
+	line, column = tok.Line, tok.Column
+	for _, r := range text {
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// nodeToken returns the Token field every node type has.
+func nodeToken(node ast.Node) (token.Token, bool) {
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return token.Token{}, false
+	}
+	field := v.Elem().FieldByName("Token")
+	if !field.IsValid() {
+		return token.Token{}, false
+	}
+	tok, ok := field.Interface().(token.Token)
+	return tok, ok
+}
@@ -0,0 +1,115 @@
+package coverage
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+const source = `let sign = fn(n) {
+  if (n < 0) { "negative" } else { if (n == 0) { "zero" } }
+};
+let unused = fn() { puts("never") };
+sign(5);
+sign(-1)
+`
+
+func run(t *testing.T) *Coverage {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	cov := New("sign.mk", source, program)
+	env := object.NewEnvironment()
+	if result := cov.Run(env); result.Inspect() != "negative" {
+		t.Fatalf("wrong result: %s", result.Inspect())
+	}
+	if env.Context().Tracer != nil {
+		t.Errorf("tracer left installed after Run")
+	}
+	return cov
+}
+
+func TestRunLeavesOuterContextAlone(t *testing.T) {
+	program := parser.New(lexer.New(source)).ParseProgram()
+	outer := object.NewEnvironment()
+	other := New("other.mk", source, program)
+	outer.SetTracer(other)
+	env := object.NewEnclosedEnvironment(outer)
+
+	New("sign.mk", source, program).Run(env)
+	if outer.Context().Tracer != other {
+		t.Errorf("Run replaced the tracer of the enclosed environment's outer context")
+	}
+	if env.Context().Tracer != other {
+		t.Errorf("Run did not restore the environment's tracer")
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	var out bytes.Buffer
+	run(t).WriteProfile(&out)
+
+	expected := `mode: count
+sign.mk:1.1,3.2 1 1
+sign.mk:2.3,2.60 1 2
+sign.mk:2.14,2.28 0 1
+sign.mk:2.16,2.26 1 1
+sign.mk:2.34,2.60 0 1
+sign.mk:2.36,2.58 1 1
+sign.mk:2.48,2.58 0 0
+sign.mk:2.50,2.56 1 0
+sign.mk:2.58,2.58 0 1
+sign.mk:4.1,4.36 1 1
+sign.mk:4.21,4.34 1 0
+sign.mk:5.1,5.8 1 1
+sign.mk:6.1,6.9 1 1
+`
+	if out.String() != expected {
+		t.Errorf("wrong profile.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestSummary(t *testing.T) {
+	cov := run(t)
+
+	if covered, total := cov.Statements(); covered != 7 || total != 9 {
+		t.Errorf("wrong statement coverage. want=7/9, got=%d/%d", covered, total)
+	}
+	if covered, total := cov.Branches(); covered != 3 || total != 4 {
+		t.Errorf("wrong branch coverage. want=3/4, got=%d/%d", covered, total)
+	}
+	if summary := cov.Summary(); summary != "coverage: 77.8% of statements, 3/4 branches" {
+		t.Errorf("wrong summary: %q", summary)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(t).WriteHTML(&out); err != nil {
+		t.Fatalf("WriteHTML failed: %s", err)
+	}
+	page := out.String()
+
+	for _, want := range []string{
+		"<title>sign.mk</title>",
+		"<p>sign.mk: coverage: 77.8% of statements, 3/4 branches</p>",
+		`<span class="ln">   4</span>  <span class="cov" title="count 1">let unused = fn() { </span>` +
+			`<span class="uncov" title="count 0">puts(&#34;never&#34;)</span>` +
+			`<span class="cov" title="count 1"> }</span>;`,
+		`<span class="cov" title="count 2">if (n &lt; 0) </span>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %q:\n%s", want, page)
+		}
+	}
+	if lines := strings.Count(page, `class="ln"`); lines != 6 {
+		t.Errorf("wrong number of source lines. want=6, got=%d", lines)
+	}
+}
@@ -0,0 +1,100 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: monospace; }
+.cov { background: #c6efce; }
+.uncov { background: #ffc7ce; }
+.ln { color: #999; }
+</style>
+</head>
+<body>
+<p>%s: %s</p>
+<pre>
+`
+
+const htmlFooter = `</pre>
+</body>
+</html>
+`
+
+// WriteHTML writes the source as an HTML page, highlighting each character
+// by the innermost statement or branch containing it: green if it ran and
+// red if it did not.
+func (c *Coverage) WriteHTML(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	name := html.EscapeString(c.filename)
+	fmt.Fprintf(w, htmlHeader, name, name, html.EscapeString(c.Summary()))
+
+	// Blocks nest, so the innermost one containing a position is the top
+	// of a stack of those that have started but not yet ended.
+	var stack []*Block
+	next := 0
+	lines := strings.Split(c.source, "\n")
+	for i, text := range lines {
+		if i == len(lines)-1 && text == "" {
+			break
+		}
+		line := i + 1
+		fmt.Fprintf(w, `<span class="ln">%4d</span>  `, line)
+
+		var open *Block
+		column := 1
+		for _, r := range text {
+			for len(stack) > 0 && !before(line, column, stack[len(stack)-1].EndLine, stack[len(stack)-1].EndColumn) {
+				stack = stack[:len(stack)-1]
+			}
+			for next < len(c.blocks) && !before(line, column, c.blocks[next].StartLine, c.blocks[next].StartColumn) {
+				block := c.blocks[next]
+				next++
+				if before(line, column, block.EndLine, block.EndColumn) {
+					stack = append(stack, block)
+				}
+			}
+
+			var block *Block
+			if len(stack) > 0 {
+				block = stack[len(stack)-1]
+			}
+			if block != open {
+				if open != nil {
+					w.WriteString("</span>")
+				}
+				if block != nil {
+					class := "cov"
+					if block.Count == 0 {
+						class = "uncov"
+					}
+					fmt.Fprintf(w, `<span class="%s" title="count %d">`, class, block.Count)
+				}
+				open = block
+			}
+			w.WriteString(html.EscapeString(string(r)))
+			column++
+		}
+		if open != nil {
+			w.WriteString("</span>")
+		}
+		w.WriteString("\n")
+	}
+
+	w.WriteString(htmlFooter)
+	return w.Flush()
+}
+
+// before reports whether line:column comes before otherLine:otherColumn.
+func before(line, column, otherLine, otherColumn int) bool {
+	return line < otherLine || line == otherLine && column < otherColumn
+}
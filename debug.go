@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/debugger"
+	"net"
+	"os"
+)
+
+// serveDebugger runs a Debug Adapter Protocol server on stdin and stdout,
+// or for a single client connecting to the address given with --listen.
+func serveDebugger(args []string) int {
+	flags := flag.NewFlagSet("dap", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	listen := flags.String("listen", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+
+	if *listen == "" {
+		if err := debugger.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer listener.Close()
+	fmt.Fprintf(os.Stderr, "debug adapter listening on %s\n", listener.Addr())
+
+	conn, err := listener.Accept()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+
+	if err := debugger.Serve(conn, conn); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
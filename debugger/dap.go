@@ -0,0 +1,446 @@
+package debugger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The debugger reports a single thread: spawned tasks are not traced.
+const threadId = 1
+
+// maxMessageSize bounds the Content-Length the adapter accepts, so that a
+// misbehaving client cannot make it allocate without limit.
+const maxMessageSize = 16 << 20
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type source struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// session is one client connection. Requests are handled on the goroutine
+// running Serve; the program runs on its own goroutine and reports stops
+// and output as events.
+type session struct {
+	in *bufio.Reader
+
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	path        string
+	debugger    *Debugger
+	breakpoints []int
+	stopOnEntry bool
+	done        chan struct{}
+
+	// handles number the environments and arrays shown as expandable
+	// variables. They are only valid while the program stays paused.
+	handles map[int]interface{}
+}
+
+// Serve speaks the Debug Adapter Protocol over in and out until the client
+// disconnects or in is closed. The client launches one program with a
+// "launch" request whose "program" argument is the script's path.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &session{in: bufio.NewReader(in), out: out, handles: map[int]interface{}{}}
+
+	for {
+		req, err := s.read()
+		if err == io.EOF {
+			s.terminate()
+			return nil
+		}
+		if err != nil {
+			s.terminate()
+			return err
+		}
+
+		if !s.handle(req) {
+			return nil
+		}
+	}
+}
+
+func (s *session) read() (*request, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil || length < 0 || length > maxMessageSize {
+		return nil, fmt.Errorf("dap: bad Content-Length %q", headers.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	req := &request{}
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, fmt.Errorf("dap: %s", err)
+	}
+	return req, nil
+}
+
+func (s *session) send(msg interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq, msg.Type = s.seq, "response"
+	case *event:
+		msg.Seq, msg.Type = s.seq, "event"
+	}
+
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *session) sendEvent(name string, body interface{}) {
+	s.send(&event{Event: name, Body: body})
+}
+
+// handle answers one request. It returns false once the client has
+// disconnected.
+func (s *session) handle(req *request) bool {
+	body, err := s.dispatch(req)
+
+	resp := &response{RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	s.send(resp)
+
+	switch {
+	case req.Command == "launch" && err == nil:
+		// Breakpoints can only be verified once the program is parsed.
+		s.sendEvent("initialized", nil)
+	case req.Command == "disconnect":
+		return false
+	}
+	return true
+}
+
+func (s *session) dispatch(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+	case "launch":
+		return nil, s.launch(req.Arguments)
+	case "setBreakpoints":
+		return s.setBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "configurationDone":
+		return nil, s.start()
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadId, "name": "main"}},
+		}, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		return s.scopes(req.Arguments)
+	case "variables":
+		return s.variables(req.Arguments)
+	case "evaluate":
+		return s.evaluate(req.Arguments)
+	case "continue", "next", "stepIn", "stepOut":
+		return s.resume(req.Command)
+	case "pause":
+		if s.debugger != nil {
+			s.debugger.Pause()
+		}
+		return nil, nil
+	case "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+func (s *session) launch(raw json.RawMessage) error {
+	var args struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s: %s", args.Program, strings.Join(p.Errors(), "; "))
+	}
+
+	env := object.NewEnvironment()
+	env.SetOutput(outputWriter{s})
+
+	s.path = args.Program
+	s.stopOnEntry = args.StopOnEntry
+	s.debugger = New(program, env, func(reason string) {
+		s.sendEvent("stopped", map[string]interface{}{
+			"reason":            reason,
+			"threadId":          threadId,
+			"allThreadsStopped": true,
+		})
+	})
+	s.debugger.SetBreakpoints(s.breakpoints)
+	return nil
+}
+
+func (s *session) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.breakpoints = []int{}
+	for _, bp := range args.Breakpoints {
+		s.breakpoints = append(s.breakpoints, bp.Line)
+	}
+
+	verified := make([]bool, len(s.breakpoints))
+	if s.debugger != nil {
+		verified = s.debugger.SetBreakpoints(s.breakpoints)
+	}
+
+	breakpoints := []map[string]interface{}{}
+	for i, line := range s.breakpoints {
+		breakpoints = append(breakpoints, map[string]interface{}{"verified": verified[i], "line": line})
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+func (s *session) start() error {
+	if s.debugger == nil {
+		return fmt.Errorf("no program launched")
+	}
+
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+
+		exitCode := 0
+		if err, ok := s.debugger.Run(s.stopOnEntry).(*object.Error); ok {
+			s.sendEvent("output", map[string]string{"category": "stderr", "output": err.Message + "\n"})
+			exitCode = 1
+		}
+		s.sendEvent("exited", map[string]int{"exitCode": exitCode})
+		s.sendEvent("terminated", nil)
+	}()
+	return nil
+}
+
+func (s *session) terminate() {
+	if s.debugger == nil || s.done == nil {
+		return
+	}
+	s.debugger.Terminate()
+	<-s.done
+}
+
+func (s *session) resume(command string) (interface{}, error) {
+	if s.debugger == nil {
+		return nil, fmt.Errorf("no program launched")
+	}
+
+	s.handles = map[int]interface{}{}
+	switch command {
+	case "continue":
+		s.debugger.Continue()
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "next":
+		s.debugger.Next()
+	case "stepIn":
+		s.debugger.StepIn()
+	case "stepOut":
+		s.debugger.StepOut()
+	}
+	return nil, nil
+}
+
+func (s *session) stackTrace() (interface{}, error) {
+	if s.debugger == nil {
+		return nil, fmt.Errorf("no program launched")
+	}
+
+	src := source{Name: filepath.Base(s.path), Path: s.path}
+	frames := []map[string]interface{}{}
+	for i, frame := range s.debugger.Frames() {
+		frames = append(frames, map[string]interface{}{
+			"id":     i,
+			"name":   frame.Name,
+			"line":   frame.Line,
+			"column": frame.Column,
+			"source": src,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// scopes lists the environment chain of a frame, innermost first.
+func (s *session) scopes(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		FrameId int `json:"frameId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	if s.debugger == nil {
+		return nil, fmt.Errorf("no program launched")
+	}
+	frames := s.debugger.Frames()
+	if args.FrameId < 0 || args.FrameId >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", args.FrameId)
+	}
+
+	scopes := []map[string]interface{}{}
+	for env := frames[args.FrameId].Env; env != nil; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env.Outer() == nil:
+			name = "Globals"
+		case len(scopes) == 0:
+			name = "Locals"
+		}
+		scopes = append(scopes, map[string]interface{}{
+			"name":               name,
+			"variablesReference": s.newHandle(env),
+			"expensive":          false,
+		})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *session) variables(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	variables := []variable{}
+	switch container := s.handles[args.VariablesReference].(type) {
+	case *object.Environment:
+		for _, name := range container.Names() {
+			val, _ := container.Get(name)
+			variables = append(variables, s.variable(name, val))
+		}
+	case *object.Array:
+		for i, el := range container.Elements {
+			variables = append(variables, s.variable(fmt.Sprintf("[%d]", i), el))
+		}
+	default:
+		return nil, fmt.Errorf("no variables with reference %d", args.VariablesReference)
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+func (s *session) evaluate(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameId    int    `json:"frameId"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if s.debugger == nil {
+		return nil, fmt.Errorf("no program launched")
+	}
+
+	result, err := s.debugger.Evaluate(args.FrameId, args.Expression)
+	if err != nil {
+		return nil, err
+	}
+	v := s.variable("", result)
+	return map[string]interface{}{
+		"result":             v.Value,
+		"type":               v.Type,
+		"variablesReference": v.VariablesReference,
+	}, nil
+}
+
+func (s *session) variable(name string, val object.Object) variable {
+	v := variable{Name: name, Value: val.Inspect(), Type: string(val.Type())}
+	if array, ok := val.(*object.Array); ok && len(array.Elements) > 0 {
+		v.VariablesReference = s.newHandle(array)
+	}
+	return v
+}
+
+func (s *session) newHandle(container interface{}) int {
+	id := len(s.handles) + 1
+	s.handles[id] = container
+	return id
+}
+
+// outputWriter forwards the program's output to the client.
+type outputWriter struct {
+	s *session
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.s.sendEvent("output", map[string]string{"category": "stdout", "output": string(p)})
+	return len(p), nil
+}
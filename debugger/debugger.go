@@ -0,0 +1,271 @@
+// Package debugger runs Monkey programs under a tracer that can pause at
+// line breakpoints, step through statements and inspect paused frames. Serve
+// exposes it to editors over the Debug Adapter Protocol.
+package debugger
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"sync"
+)
+
+type stepMode int
+
+const (
+	running stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+	terminate
+)
+
+// Frame is an active function call. Line and Column give the statement it
+// is executing and Env the innermost scope of that statement.
+type Frame struct {
+	Name   string
+	Line   int
+	Column int
+	Env    *object.Environment
+
+	lastLine int // line of the previous statement, so a breakpoint fires once per visit
+}
+
+// Debugger evaluates one program. Run blocks on the evaluating goroutine
+// while the program is paused; the other methods are called from elsewhere
+// to set breakpoints, inspect the paused program and resume it.
+type Debugger struct {
+	program *ast.Program
+	env     *object.Environment
+	onStop  func(reason string)
+
+	mu             sync.Mutex
+	breakpoints    map[int]bool
+	frames         []*Frame
+	mode           stepMode
+	stepDepth      int
+	stopOnEntry    bool
+	pauseRequested bool
+	stopped        bool
+	terminated     bool
+	resume         chan stepMode
+}
+
+// New prepares program for evaluation in env. onStop is called on the
+// evaluating goroutine each time the program pauses, with the reason
+// "entry", "breakpoint", "step" or "pause".
+func New(program *ast.Program, env *object.Environment, onStop func(reason string)) *Debugger {
+	return &Debugger{
+		program:     program,
+		env:         env,
+		onStop:      onStop,
+		breakpoints: map[int]bool{},
+		resume:      make(chan stepMode),
+	}
+}
+
+// SetBreakpoints replaces the line breakpoints. A breakpoint is verified if
+// a statement starts on its line.
+func (d *Debugger) SetBreakpoints(lines []int) []bool {
+	statementLines := map[int]bool{}
+	ast.Walk(d.program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			statementLines[ast.StatementToken(stmt).Line] = true
+		}
+		return true
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints = map[int]bool{}
+	verified := make([]bool, len(lines))
+	for i, line := range lines {
+		d.breakpoints[line] = true
+		verified[i] = statementLines[line]
+	}
+	return verified
+}
+
+// Run evaluates the program, pausing before the first statement if
+// stopOnEntry is set, and returns its result.
+func (d *Debugger) Run(stopOnEntry bool) object.Object {
+	d.mu.Lock()
+	d.frames = []*Frame{{Name: "main", Env: d.env}}
+	d.stopOnEntry = stopOnEntry
+	d.mu.Unlock()
+
+	d.env.SetTracer(&tracer{d})
+	result := evaluator.Eval(d.program, d.env)
+
+	d.mu.Lock()
+	d.terminated = true
+	d.frames = nil
+	d.mu.Unlock()
+
+	return result
+}
+
+// Continue resumes a paused program until the next breakpoint.
+func (d *Debugger) Continue() { d.resumeWith(running) }
+
+// Next resumes a paused program until the next statement in the current
+// function or a caller.
+func (d *Debugger) Next() { d.resumeWith(stepOver) }
+
+// StepIn resumes a paused program until the next statement anywhere,
+// including inside a function called by the current statement.
+func (d *Debugger) StepIn() { d.resumeWith(stepIn) }
+
+// StepOut resumes a paused program until the next statement in a caller of
+// the current function.
+func (d *Debugger) StepOut() { d.resumeWith(stepOut) }
+
+// Pause asks a running program to stop before its next statement.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pauseRequested = true
+}
+
+// Terminate aborts the program before its next statement.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	d.terminated = true
+	d.mu.Unlock()
+
+	d.resumeWith(terminate)
+}
+
+func (d *Debugger) resumeWith(mode stepMode) {
+	d.mu.Lock()
+	stopped := d.stopped
+	d.mu.Unlock()
+
+	if stopped {
+		d.resume <- mode
+	}
+}
+
+// Frames returns the active calls of a paused program, innermost first.
+func (d *Debugger) Frames() []Frame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	frames := make([]Frame, 0, len(d.frames))
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		frames = append(frames, *d.frames[i])
+	}
+	return frames
+}
+
+// Evaluate evaluates source in the scope of a frame of the paused program,
+// numbered as returned by Frames. Bindings it makes do not outlive it.
+func (d *Debugger) Evaluate(frameIndex int, source string) (object.Object, error) {
+	frames := d.Frames()
+	if frameIndex < 0 || frameIndex >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", frameIndex)
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "; "))
+	}
+
+	frameEnv := frames[frameIndex].Env
+	env := object.NewEnclosedEnvironment(frameEnv)
+	env.SetContext(frameEnv.Context().Untraced())
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		result = evaluator.NULL
+	}
+	return result, nil
+}
+
+// tracer receives evaluation events on the evaluating goroutine.
+type tracer struct {
+	d *Debugger
+}
+
+func (t *tracer) Statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	d := t.d
+	tok := ast.StatementToken(stmt)
+
+	d.mu.Lock()
+	if d.terminated {
+		d.mu.Unlock()
+		return &object.Error{Message: "terminated by debugger"}
+	}
+
+	frame := d.frames[len(d.frames)-1]
+	newLine := frame.lastLine != tok.Line
+	frame.Line, frame.Column, frame.Env, frame.lastLine = tok.Line, tok.Column, env, tok.Line
+	depth := len(d.frames)
+
+	reason := ""
+	switch {
+	case d.stopOnEntry:
+		reason = "entry"
+	case d.pauseRequested:
+		reason = "pause"
+	case d.mode == stepIn,
+		d.mode == stepOver && depth <= d.stepDepth,
+		d.mode == stepOut && depth < d.stepDepth:
+		reason = "step"
+	case d.breakpoints[tok.Line] && newLine:
+		reason = "breakpoint"
+	}
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+
+	d.stopOnEntry = false
+	d.pauseRequested = false
+	d.stopped = true
+	d.mu.Unlock()
+
+	d.onStop(reason)
+	mode := <-d.resume
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = false
+	if mode == terminate {
+		return &object.Error{Message: "terminated by debugger"}
+	}
+	d.mode = mode
+	d.stepDepth = len(d.frames)
+	return nil
+}
+
+func (t *tracer) Call(fn object.Object, env *object.Environment) {
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return
+	}
+
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.frames = append(t.d.frames, &Frame{
+		Name:   function.Label(),
+		Line:   function.Token.Line,
+		Column: function.Token.Column,
+		Env:    env,
+	})
+}
+
+func (t *tracer) Return(fn object.Object, result object.Object) {
+	if _, ok := fn.(*object.Function); !ok {
+		return
+	}
+
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.frames = t.d.frames[:len(t.d.frames)-1]
+}
@@ -0,0 +1,365 @@
+package debugger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const program = `let add = fn(a, b) {
+  let s = a + b;
+  s
+};
+let x = add(1, 2);
+let y = x * 2;
+y
+`
+
+type run struct {
+	d      *Debugger
+	stops  chan string
+	result chan object.Object
+}
+
+func start(t *testing.T, breakpoints []int, stopOnEntry bool) *run {
+	t.Helper()
+	p := parser.New(lexer.New(program))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	r := &run{stops: make(chan string), result: make(chan object.Object, 1)}
+	r.d = New(prog, object.NewEnvironment(), func(reason string) { r.stops <- reason })
+	r.d.SetBreakpoints(breakpoints)
+	go func() { r.result <- r.d.Run(stopOnEntry) }()
+	return r
+}
+
+// expectStop waits for the program to pause and checks why and where.
+func (r *run) expectStop(t *testing.T, reason string, line, depth int) {
+	t.Helper()
+	select {
+	case got := <-r.stops:
+		if got != reason {
+			t.Fatalf("stop reason wrong. want=%q, got=%q", reason, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("program did not stop with %q", reason)
+	}
+
+	frames := r.d.Frames()
+	if len(frames) != depth {
+		t.Fatalf("wrong number of frames. want=%d, got=%d", depth, len(frames))
+	}
+	if frames[0].Line != line {
+		t.Fatalf("stopped on wrong line. want=%d, got=%d", line, frames[0].Line)
+	}
+}
+
+func (r *run) expectResult(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-r.result:
+		if got.Inspect() != want {
+			t.Fatalf("wrong result. want=%q, got=%q", want, got.Inspect())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("program did not finish")
+	}
+}
+
+func (r *run) expectEvaluate(t *testing.T, frame int, source, want string) {
+	t.Helper()
+	got, err := r.d.Evaluate(frame, source)
+	if err != nil {
+		t.Fatalf("Evaluate(%d, %q) failed: %s", frame, source, err)
+	}
+	if got.Inspect() != want {
+		t.Fatalf("Evaluate(%d, %q) wrong. want=%q, got=%q", frame, source, want, got.Inspect())
+	}
+}
+
+func TestSetBreakpoints(t *testing.T) {
+	r := start(t, nil, true)
+	r.expectStop(t, "entry", 1, 1)
+
+	verified := r.d.SetBreakpoints([]int{2, 4, 6})
+	if fmt.Sprint(verified) != "[true false true]" {
+		t.Errorf("wrong verified breakpoints: %v", verified)
+	}
+
+	r.d.Continue()
+	r.expectStop(t, "breakpoint", 2, 2)
+	r.d.Continue()
+	r.expectStop(t, "breakpoint", 6, 1)
+	r.d.Continue()
+	r.expectResult(t, "6")
+}
+
+func TestBreakpointInspection(t *testing.T) {
+	r := start(t, []int{2}, false)
+	r.expectStop(t, "breakpoint", 2, 2)
+
+	frames := r.d.Frames()
+	if frames[0].Name != "add (1:11)" || frames[1].Name != "main" {
+		t.Fatalf("wrong frame names: %q, %q", frames[0].Name, frames[1].Name)
+	}
+
+	r.expectEvaluate(t, 0, "a + b", "3")
+	r.expectEvaluate(t, 0, "let a = 10; a", "10")
+	r.expectEvaluate(t, 0, "a", "1")
+	r.expectEvaluate(t, 1, "a", "ERROR: identifier not found: a")
+	if _, err := r.d.Evaluate(2, "a"); err == nil {
+		t.Errorf("expected an error for a missing frame")
+	}
+	if _, err := r.d.Evaluate(0, "let"); err == nil {
+		t.Errorf("expected a parse error")
+	}
+
+	r.d.Continue()
+	r.expectResult(t, "6")
+}
+
+func TestStepping(t *testing.T) {
+	r := start(t, nil, true)
+	r.expectStop(t, "entry", 1, 1)
+
+	r.d.Next()
+	r.expectStop(t, "step", 5, 1)
+	r.d.StepIn()
+	r.expectStop(t, "step", 2, 2)
+	r.d.Next()
+	r.expectStop(t, "step", 3, 2)
+	r.d.StepOut()
+	r.expectStop(t, "step", 6, 1)
+	r.expectEvaluate(t, 0, "x", "3")
+	r.d.Next()
+	r.expectStop(t, "step", 7, 1)
+	r.d.Continue()
+	r.expectResult(t, "6")
+}
+
+func TestStepOverCall(t *testing.T) {
+	r := start(t, []int{5}, false)
+	r.expectStop(t, "breakpoint", 5, 1)
+	r.d.Next()
+	r.expectStop(t, "step", 6, 1)
+	r.d.Continue()
+	r.expectResult(t, "6")
+}
+
+func TestTerminate(t *testing.T) {
+	r := start(t, []int{3}, false)
+	r.expectStop(t, "breakpoint", 3, 2)
+	r.d.Terminate()
+	r.expectResult(t, "ERROR: terminated by debugger")
+}
+
+func TestRunLeavesOuterContextUntraced(t *testing.T) {
+	p := parser.New(lexer.New("let x = 1; x"))
+	prog := p.ParseProgram()
+	outer := object.NewEnvironment()
+	env := object.NewEnclosedEnvironment(outer)
+
+	d := New(prog, env, func(reason string) {})
+	if result := d.Run(false); result.Inspect() != "1" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+	if outer.Context().Tracer != nil {
+		t.Errorf("debugger traced the enclosed environment's outer context")
+	}
+}
+
+// client drives Serve through a pair of pipes.
+type client struct {
+	t   *testing.T
+	in  *io.PipeWriter
+	out *bufio.Reader
+	seq int
+}
+
+type message struct {
+	Type       string                 `json:"type"`
+	Command    string                 `json:"command"`
+	Event      string                 `json:"event"`
+	RequestSeq int                    `json:"request_seq"`
+	Success    bool                   `json:"success"`
+	Message    string                 `json:"message"`
+	Body       map[string]interface{} `json:"body"`
+}
+
+func (c *client) request(command string, arguments interface{}) {
+	c.t.Helper()
+	c.seq++
+	body, _ := json.Marshal(map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": arguments,
+	})
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("writing %s: %s", command, err)
+	}
+}
+
+func (c *client) read() message {
+	c.t.Helper()
+	var length int
+	if _, err := fmt.Fscanf(c.out, "Content-Length: %d\r\n\r\n", &length); err != nil {
+		c.t.Fatalf("reading header: %s", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.out, body); err != nil {
+		c.t.Fatalf("reading body: %s", err)
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatalf("decoding %s: %s", body, err)
+	}
+	return msg
+}
+
+// expect reads messages until one of the given type and name, which is a
+// command for responses and an event name for events. Output events are
+// collected into output on the way.
+func (c *client) expect(typ, name string, output *string) message {
+	c.t.Helper()
+	for {
+		msg := c.read()
+		if msg.Type == "event" && msg.Event == "output" && output != nil {
+			*output += msg.Body["output"].(string)
+		}
+		if msg.Type == typ && (msg.Command == name || msg.Event == name) {
+			if typ == "response" && !msg.Success {
+				c.t.Fatalf("%s failed: %s", name, msg.Message)
+			}
+			return msg
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.mk")
+	source := "let double = fn(n) {\n  n * 2\n};\nputs(double(21));\nputs(\"done\");\n"
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(inR, outW)
+		outW.Close()
+	}()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR)}
+
+	c.request("initialize", map[string]string{"adapterID": "monkey"})
+	c.expect("response", "initialize", nil)
+	c.request("launch", map[string]interface{}{"program": path})
+	c.expect("response", "launch", nil)
+	c.expect("event", "initialized", nil)
+
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 2}, {"line": 3}},
+	})
+	bps := c.expect("response", "setBreakpoints", nil).Body["breakpoints"].([]interface{})
+	if bps[0].(map[string]interface{})["verified"] != true || bps[1].(map[string]interface{})["verified"] != false {
+		t.Errorf("wrong breakpoint verification: %v", bps)
+	}
+
+	c.request("configurationDone", nil)
+	c.expect("response", "configurationDone", nil)
+	if reason := c.expect("event", "stopped", nil).Body["reason"]; reason != "breakpoint" {
+		t.Errorf("wrong stop reason: %v", reason)
+	}
+
+	c.request("stackTrace", map[string]int{"threadId": threadId})
+	frames := c.expect("response", "stackTrace", nil).Body["stackFrames"].([]interface{})
+	if len(frames) != 2 {
+		t.Fatalf("wrong number of frames: %v", frames)
+	}
+	top := frames[0].(map[string]interface{})
+	if top["name"] != "double (1:14)" || top["line"] != float64(2) {
+		t.Errorf("wrong top frame: %v", top)
+	}
+
+	c.request("scopes", map[string]int{"frameId": 0})
+	scopes := c.expect("response", "scopes", nil).Body["scopes"].([]interface{})
+	locals := scopes[0].(map[string]interface{})
+	if locals["name"] != "Locals" || scopes[len(scopes)-1].(map[string]interface{})["name"] != "Globals" {
+		t.Fatalf("wrong scopes: %v", scopes)
+	}
+
+	c.request("variables", map[string]interface{}{"variablesReference": locals["variablesReference"]})
+	vars := c.expect("response", "variables", nil).Body["variables"].([]interface{})
+	if len(vars) != 1 || vars[0].(map[string]interface{})["name"] != "n" || vars[0].(map[string]interface{})["value"] != "21" {
+		t.Errorf("wrong locals: %v", vars)
+	}
+
+	c.request("evaluate", map[string]interface{}{"expression": "[n, n + 1]", "frameId": 0})
+	evaluated := c.expect("response", "evaluate", nil).Body
+	if evaluated["result"] != "[21, 22]" || evaluated["variablesReference"] == float64(0) {
+		t.Errorf("wrong evaluation: %v", evaluated)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadId})
+	c.expect("response", "continue", nil)
+	output := ""
+	exited := c.expect("event", "exited", &output)
+	if exited.Body["exitCode"] != float64(0) {
+		t.Errorf("wrong exit code: %v", exited.Body)
+	}
+	if output != "42\ndone\n" {
+		t.Errorf("wrong output: %q", output)
+	}
+	c.expect("event", "terminated", nil)
+
+	c.request("disconnect", nil)
+	c.expect("response", "disconnect", nil)
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %s", err)
+	}
+}
+
+func TestServeBeforeLaunch(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(inR, outW)
+		outW.Close()
+	}()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR)}
+
+	for _, command := range []string{"scopes", "stackTrace", "evaluate", "continue"} {
+		c.request(command, map[string]int{"frameId": 0, "threadId": threadId})
+		msg := c.read()
+		if msg.Type != "response" || msg.Command != command || msg.Success || msg.Message != "no program launched" {
+			t.Errorf("%s before launch: got %+v, want a failed response", command, msg)
+		}
+	}
+
+	inW.Close()
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %s", err)
+	}
+}
+
+func TestServeBadContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "x", "99999999999"} {
+		input := "Content-Length: " + length + "\r\n\r\n{}"
+		err := Serve(strings.NewReader(input), io.Discard)
+		if want := fmt.Sprintf("dap: bad Content-Length %q", length); err == nil || err.Error() != want {
+			t.Errorf("Content-Length %s: got error %v, want %q", length, err, want)
+		}
+	}
+}
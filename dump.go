@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"os"
+)
+
+// dumpAST prints the syntax tree of a script as indented JSON or as a
+// Graphviz graph.
+func dumpAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "json", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+
+	if *format != "json" && *format != "dot" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, want json or dot\n", *format)
+		return 2
+	}
+
+	program, ok := parseFile(flags.Arg(0))
+	if !ok {
+		return 1
+	}
+
+	if *format == "dot" {
+		fmt.Print(ast.ToDOT(program))
+		return 0
+	}
+
+	var out bytes.Buffer
+	json.Indent(&out, ast.ToJSON(program), "", "  ")
+	out.WriteString("\n")
+	out.WriteTo(os.Stdout)
+
+	return 0
+}
+
+// dumpTokens prints the tokens of a script as a table or as JSON lines.
+func dumpTokens(args []string) int {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "table", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, want table or json\n", *format)
+		return 2
+	}
+
+	source, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	tokens := lexer.Tokenize(string(source))
+	if *format == "table" {
+		token.WriteTable(os.Stdout, tokens)
+		return 0
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, tok := range tokens {
+		encoder.Encode(tok)
+	}
+
+	return 0
+}
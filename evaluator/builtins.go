@@ -1,99 +1,232 @@
 package evaluator
 
 import (
+	"fmt"
 	"monkey/object"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
-			}
-
-			return NULL
-		},
-	},
-	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				return arr.Elements[length - 1]
-			}
-
-			return NULL
+// builtins is filled from builtin definitions at init time. Definitions
+// call back into applyFunction, which reaches this map through Eval, so the
+// map cannot be built in its own initializer.
+var builtins = map[string]*object.Builtin{}
+
+var builtinDefinitions = map[string]*builtinDefinition{}
+
+// builtinParam names a builtin parameter and lists the object types it
+// accepts. A parameter without types accepts anything.
+type builtinParam struct {
+	name  string
+	types []object.ObjectType
+}
+
+// builtinDefinition declares a builtin's signature and documentation. The
+// arguments are validated against the signature before fn is called, so fn
+// may assume the argument count and types are correct.
+type builtinDefinition struct {
+	name     string
+	params   []builtinParam
+	optional int  // number of trailing parameters that may be omitted
+	variadic bool // the last parameter may repeat zero or more times
+	doc      string
+	fn       object.BuiltinFunction
+}
+
+func param(name string, types ...object.ObjectType) builtinParam {
+	return builtinParam{name: name, types: types}
+}
+
+var (
+	callableTypes  = []object.ObjectType{object.FUNCTION_OBJ, object.BUILTIN_OBJ}
+	collectionType = []object.ObjectType{object.ARRAY_OBJ, object.ITERATOR_OBJ}
+)
+
+func defineBuiltins(definitions ...*builtinDefinition) {
+	for _, def := range definitions {
+		def := def
+		builtinDefinitions[def.name] = def
+		builtins[def.name] = &object.Builtin{
+			Name: def.name,
+			Fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if err := def.validate(args); err != nil {
+					return err
+				}
+				return def.fn(env, args...)
+			},
+		}
+	}
+}
+
+func (def *builtinDefinition) validate(args []object.Object) *object.Error {
+	min := len(def.params) - def.optional
+	max := len(def.params)
+	if def.variadic {
+		min--
+	}
+
+	switch {
+	case def.variadic && len(args) < min:
+		return newError("wrong number of arguments. got=%d, want at least %d", len(args), min)
+	case !def.variadic && min == max && len(args) != min:
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), min)
+	case !def.variadic && (len(args) < min || len(args) > max):
+		return newError("wrong number of arguments. got=%d, want=%d to %d", len(args), min, max)
+	}
+
+	for i, arg := range args {
+		p := def.params[len(def.params)-1]
+		if i < len(def.params) {
+			p = def.params[i]
+		}
+		if !p.accepts(arg) {
+			return newError("argument `%s` to `%s` must be %s, got %s",
+				p.name, def.name, p.typeNames(" or "), arg.Type())
+		}
+	}
+
+	return nil
+}
+
+func (p builtinParam) accepts(arg object.Object) bool {
+	if len(p.types) == 0 {
+		return true
+	}
+	for _, t := range p.types {
+		if arg.Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (p builtinParam) typeNames(sep string) string {
+	if len(p.types) == 0 {
+		return "ANY"
+	}
+	names := []string{}
+	for _, t := range p.types {
+		names = append(names, string(t))
+	}
+	return strings.Join(names, sep)
+}
+
+// signature renders the declared parameters, e.g. `slice(array: ARRAY, start: INTEGER, end?: INTEGER)`.
+func (def *builtinDefinition) signature() string {
+	params := []string{}
+	for i, p := range def.params {
+		name := p.name
+		if i >= len(def.params)-def.optional {
+			name += "?"
+		}
+		if def.variadic && i == len(def.params)-1 {
+			name += "..."
+		}
+		params = append(params, fmt.Sprintf("%s: %s", name, p.typeNames(" | ")))
+	}
+	return fmt.Sprintf("%s(%s)", def.name, strings.Join(params, ", "))
+}
+
+// BuiltinHelp returns the signature and documentation of a builtin.
+func BuiltinHelp(name string) (string, bool) {
+	def, ok := builtinDefinitions[name]
+	if !ok {
+		return "", false
+	}
+	return def.signature() + "\n    " + def.doc, true
+}
+
+// LookupBuiltin returns the builtin called name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// BuiltinNames lists every builtin in alphabetical order.
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range builtinDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:   "len",
+			params: []builtinParam{param("value", object.STRING_OBJ, object.ARRAY_OBJ, object.MAP_OBJ)},
+			doc:    "Returns the number of characters in a string, elements in an array or keys in a map.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				switch arg := args[0].(type) {
+				case *object.String:
+					return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				case *object.Map:
+					return &object.Integer{Value: int64(arg.Len())}
+				default:
+					return &object.Integer{Value: int64(len(arg.(*object.Array).Elements))}
+				}
+			},
 		},
-	},
-	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
-			}
-
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]object.Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
-			}
+		&builtinDefinition{
+			name:   "first",
+			params: []builtinParam{param("array", object.ARRAY_OBJ)},
+			doc:    "Returns the first element of an array, or null if it is empty.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				arr := args[0].(*object.Array)
+				if len(arr.Elements) > 0 {
+					return arr.Elements[0]
+				}
 
-			return NULL
+				return NULL
+			},
 		},
-	},
-	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
+		&builtinDefinition{
+			name:   "last",
+			params: []builtinParam{param("array", object.ARRAY_OBJ)},
+			doc:    "Returns the last element of an array, or null if it is empty.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				arr := args[0].(*object.Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					return arr.Elements[length-1]
+				}
 
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
-			}
+				return NULL
+			},
+		},
+		&builtinDefinition{
+			name:   "rest",
+			params: []builtinParam{param("array", object.ARRAY_OBJ)},
+			doc:    "Returns a new array without the first element, or null if it is empty.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				arr := args[0].(*object.Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					newElements := make([]object.Object, length-1, length-1)
+					copy(newElements, arr.Elements[1:length])
+					return &object.Array{Elements: newElements}
+				}
 
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
+				return NULL
+			},
+		},
+		&builtinDefinition{
+			name:   "push",
+			params: []builtinParam{param("array", object.ARRAY_OBJ), param("value")},
+			doc:    "Returns a new array with value appended.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				arr := args[0].(*object.Array)
+				length := len(arr.Elements)
 
-			newElements := make([]object.Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
+				newElements := make([]object.Object, length+1, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
 
-			return &object.Array{Elements: newElements}
+				return &object.Array{Elements: newElements}
+			},
 		},
-	},
+	)
 }
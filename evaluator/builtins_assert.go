@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:     "assert",
+			params:   []builtinParam{param("condition"), param("message", object.STRING_OBJ)},
+			optional: 1,
+			doc:      "Raises an error, with message if given, unless condition is truthy.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if isTruthy(args[0]) {
+					return NULL
+				}
+				if len(args) == 2 {
+					return newError("assertion failed: %s", stringArg(args[1]))
+				}
+				return newError("assertion failed")
+			},
+		},
+		&builtinDefinition{
+			name:   "assert_eq",
+			params: []builtinParam{param("actual"), param("expected")},
+			doc:    "Raises an error showing where they differ unless actual equals expected.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if objectsEqual(args[0], args[1]) {
+					return NULL
+				}
+				return newError("assert_eq failed\n%s", inspectDiff(args[0], args[1]))
+			},
+		},
+	)
+}
+
+// inspectDiff shows how the Inspect output of got differs from want. A
+// single line is marked with a caret where the two first differ; longer
+// output is compared line by line.
+func inspectDiff(got, want object.Object) string {
+	gotText, wantText := got.Inspect(), want.Inspect()
+	if gotText == wantText {
+		return fmt.Sprintf("got:  %s (%s)\nwant: %s (%s)", gotText, got.Type(), wantText, want.Type())
+	}
+
+	gotLines, wantLines := strings.Split(gotText, "\n"), strings.Split(wantText, "\n")
+	if len(gotLines) == 1 && len(wantLines) == 1 {
+		same := 0
+		for same < len(gotText) && same < len(wantText) && gotText[same] == wantText[same] {
+			same++
+		}
+		// Back up to the start of the rune the texts differ in.
+		for same > 0 && same < len(gotText) && !utf8.RuneStart(gotText[same]) {
+			same--
+		}
+		caret := strings.Repeat(" ", len("want: ")+utf8.RuneCountInString(gotText[:same])) + "^"
+		return fmt.Sprintf("got:  %s\nwant: %s\n%s", gotText, wantText, caret)
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		switch {
+		case i >= len(gotLines):
+			fmt.Fprintf(&out, "- %s\n", wantLines[i])
+		case i >= len(wantLines):
+			fmt.Fprintf(&out, "+ %s\n", gotLines[i])
+		case gotLines[i] == wantLines[i]:
+			fmt.Fprintf(&out, "  %s\n", gotLines[i])
+		default:
+			fmt.Fprintf(&out, "- %s\n+ %s\n", wantLines[i], gotLines[i])
+		}
+	}
+	return "- want\n+ got\n" + strings.TrimSuffix(out.String(), "\n")
+}
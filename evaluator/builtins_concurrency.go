@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:   "spawn",
+			params: []builtinParam{param("fn", callableTypes...)},
+			doc:    "Calls fn with no arguments on a new task and returns the task without waiting for it.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return spawn(args[0], env)
+			},
+		},
+		&builtinDefinition{
+			name:   "await",
+			params: []builtinParam{param("task", object.TASK_OBJ)},
+			doc:    "Waits for task to finish and returns its result. An error raised by the task is raised again here.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				task := args[0].(*object.Task)
+				<-task.Done
+				return task.Result
+			},
+		},
+		&builtinDefinition{
+			name:     "channel",
+			params:   []builtinParam{param("capacity", object.INTEGER_OBJ)},
+			optional: 1,
+			doc:      "Returns a channel that buffers up to capacity values; without a capacity sends wait for a receiver.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				capacity := int64(0)
+				if len(args) == 1 {
+					capacity = args[0].(*object.Integer).Value
+				}
+				if capacity < 0 {
+					return newError("`channel` capacity must not be negative, got %d", capacity)
+				}
+				return object.NewChannel(int(capacity))
+			},
+		},
+		&builtinDefinition{
+			name:   "send",
+			params: []builtinParam{param("channel", object.CHANNEL_OBJ), param("value")},
+			doc:    "Sends value on channel, waiting until it is received or buffered.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if !args[0].(*object.Channel).Send(args[1]) {
+					return newError("send on closed channel")
+				}
+				return NULL
+			},
+		},
+		&builtinDefinition{
+			name:   "recv",
+			params: []builtinParam{param("channel", object.CHANNEL_OBJ)},
+			doc:    "Waits for a value on channel and returns it, or null once the channel is closed and drained.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if val, ok := args[0].(*object.Channel).Receive(); ok {
+					return val
+				}
+				return NULL
+			},
+		},
+		&builtinDefinition{
+			name:   "close",
+			params: []builtinParam{param("channel", object.CHANNEL_OBJ)},
+			doc:    "Closes channel. Pending values can still be received.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if !args[0].(*object.Channel).Close() {
+					return newError("close of closed channel")
+				}
+				return NULL
+			},
+		},
+	)
+}
+
+// spawn runs fn on a new goroutine. The task shares the caller's input and
+// output, but not its Tracer, and the environment fn closes over. Whatever
+// fn returns, including an error, becomes the task's result; a Go panic is
+// turned into an error rather than taking down the whole program.
+func spawn(fn object.Object, env *object.Environment) *object.Task {
+	task := &object.Task{Done: make(chan struct{})}
+
+	go func() {
+		defer close(task.Done)
+		defer func() {
+			if r := recover(); r != nil {
+				task.Result = newError("task panicked: %v", r)
+			}
+		}()
+
+		taskEnv := object.NewEnclosedEnvironment(env)
+		taskEnv.SetContext(env.Context().Untraced())
+		task.Result = callback(fn, []object.Object{}, taskEnv)
+	}()
+
+	return task
+}
@@ -0,0 +1,195 @@
+package evaluator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"monkey/object"
+	"strings"
+)
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:     "puts",
+			params:   []builtinParam{param("values")},
+			variadic: true,
+			doc:      "Writes each value to the output on its own line and returns null.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				ctx := env.Context()
+				ctx.Lock()
+				defer ctx.Unlock()
+
+				for _, arg := range args {
+					io.WriteString(ctx.Out, arg.Inspect()+"\n")
+				}
+
+				return NULL
+			},
+		},
+		&builtinDefinition{
+			name:     "print",
+			params:   []builtinParam{param("values")},
+			variadic: true,
+			doc:      "Writes the values to the output separated by spaces, without a newline.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				parts := []string{}
+				for _, arg := range args {
+					parts = append(parts, arg.Inspect())
+				}
+				ctx := env.Context()
+				ctx.Lock()
+				defer ctx.Unlock()
+
+				io.WriteString(ctx.Out, strings.Join(parts, " "))
+
+				return NULL
+			},
+		},
+		&builtinDefinition{
+			name:     "format",
+			params:   []builtinParam{param("format", object.STRING_OBJ), param("values")},
+			variadic: true,
+			doc:      "Returns format with %d, %s, %t and %v replaced by the values; %% is a literal %.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return formatString(args[0].(*object.String).Value, args[1:])
+			},
+		},
+		&builtinDefinition{
+			name: "readline",
+			doc:  "Reads the next line of input without its line terminator, or null at end of input.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				ctx := env.Context()
+				ctx.Lock()
+				defer ctx.Unlock()
+
+				line, ok := readLine(ctx.In)
+				if !ok {
+					return NULL
+				}
+
+				return &object.String{Value: line}
+			},
+		},
+		&builtinDefinition{
+			name: "read_all",
+			doc:  "Reads the remaining input, or null at end of input.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				ctx := env.Context()
+				ctx.Lock()
+				defer ctx.Unlock()
+
+				data, err := io.ReadAll(ctx.In)
+				if err != nil {
+					return newError("read_all: %s", err)
+				}
+				if len(data) == 0 {
+					return NULL
+				}
+
+				return &object.String{Value: string(data)}
+			},
+		},
+		&builtinDefinition{
+			name: "lines",
+			doc:  "Returns an iterator that reads one line of input each time it is advanced.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				ctx := env.Context()
+				return &object.Iterator{
+					Next: func() (object.Object, bool) {
+						ctx.Lock()
+						defer ctx.Unlock()
+
+						line, ok := readLine(ctx.In)
+						if !ok {
+							return nil, false
+						}
+						return &object.String{Value: line}, true
+					},
+				}
+			},
+		},
+		&builtinDefinition{
+			name:   "next",
+			params: []builtinParam{param("iterator", object.ITERATOR_OBJ)},
+			doc:    "Advances an iterator and returns its next value, or null once it is exhausted.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if val, ok := args[0].(*object.Iterator).Next(); ok {
+					return val
+				}
+
+				return NULL
+			},
+		},
+	)
+}
+
+// readLine reads the next line from in without its line terminator. It
+// reports false at end of input.
+func readLine(in *bufio.Reader) (string, bool) {
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, true
+}
+
+// formatString implements the `format` builtin. It understands %d, %s, %t,
+// %v and %%, checking each argument against its verb.
+func formatString(format string, args []object.Object) object.Object {
+	var out bytes.Buffer
+	argIdx := 0
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		if i >= len(format) {
+			return newError("format string ends with a lone %%")
+		}
+
+		verb := format[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if argIdx >= len(args) {
+			return newError("missing argument for %%%c in format string", verb)
+		}
+		arg := args[argIdx]
+		argIdx++
+
+		switch verb {
+		case 'd':
+			integer, ok := arg.(*object.Integer)
+			if !ok {
+				return newError("format verb %%d expects INTEGER, got %s", arg.Type())
+			}
+			fmt.Fprintf(&out, "%d", integer.Value)
+		case 't':
+			boolean, ok := arg.(*object.Boolean)
+			if !ok {
+				return newError("format verb %%t expects BOOLEAN, got %s", arg.Type())
+			}
+			fmt.Fprintf(&out, "%t", boolean.Value)
+		case 's', 'v':
+			out.WriteString(arg.Inspect())
+		default:
+			return newError("unknown format verb %%%c", verb)
+		}
+	}
+
+	if argIdx < len(args) {
+		return newError("too many arguments for format string. got=%d, want=%d", len(args), argIdx)
+	}
+
+	return &object.String{Value: out.String()}
+}
@@ -0,0 +1,434 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"monkey/object"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxJSONIndent is the widest indent json_stringify accepts, as in
+// JavaScript's JSON.stringify.
+const maxJSONIndent = 10
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:   "json_parse",
+			params: []builtinParam{param("str", object.STRING_OBJ)},
+			doc:    "Decodes the JSON document in str. Objects become maps that keep their key order; numbers with a fraction or exponent become floats.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return parseJSON(stringArg(args[0]))
+			},
+		},
+		&builtinDefinition{
+			name:     "json_stringify",
+			params:   []builtinParam{param("value"), param("indent", object.INTEGER_OBJ, object.STRING_OBJ)},
+			optional: 1,
+			doc:      "Encodes value as JSON, on one line or, given an indent of up to 10 spaces or a string, one element per line.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				indent := ""
+				if len(args) == 2 {
+					switch arg := args[1].(type) {
+					case *object.Integer:
+						if arg.Value < 0 || arg.Value > maxJSONIndent {
+							return newError("`json_stringify` indent must be between 0 and %d, got %d", maxJSONIndent, arg.Value)
+						}
+						indent = strings.Repeat(" ", int(arg.Value))
+					case *object.String:
+						indent = arg.Value
+					}
+				}
+
+				var out bytes.Buffer
+				if err := writeJSON(&out, args[0], indent, 0); err != nil {
+					return err
+				}
+				return &object.String{Value: out.String()}
+			},
+		},
+		&builtinDefinition{
+			name:   "keys",
+			params: []builtinParam{param("map", object.MAP_OBJ)},
+			doc:    "Returns the keys of map in order.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return stringArray(args[0].(*object.Map).Keys())
+			},
+		},
+	)
+}
+
+// JSON decoding
+
+// maxJSONDepth bounds how deeply arrays and objects may nest, so that
+// hostile input cannot overflow the stack of the recursive parser.
+const maxJSONDepth = 1000
+
+// jsonParser decodes a JSON document. The first error stops it and is
+// reported with the line and column it was found at.
+type jsonParser struct {
+	input string
+	pos   int
+	depth int
+}
+
+func parseJSON(input string) object.Object {
+	p := &jsonParser{input: input}
+	val := p.value()
+	if _, ok := val.(*object.Error); ok {
+		return val
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.unexpected()
+	}
+	return val
+}
+
+func (p *jsonParser) value() object.Object {
+	p.skipSpace()
+	if p.pos == len(p.input) {
+		return p.unexpected()
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '{' || c == '[':
+		if p.depth == maxJSONDepth {
+			return p.errorf("nesting too deep")
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+		if c == '{' {
+			return p.object()
+		}
+		return p.array()
+	case c == '"':
+		s, err := p.string()
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: s}
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	case strings.HasPrefix(p.input[p.pos:], "true"):
+		p.pos += len("true")
+		return TRUE
+	case strings.HasPrefix(p.input[p.pos:], "false"):
+		p.pos += len("false")
+		return FALSE
+	case strings.HasPrefix(p.input[p.pos:], "null"):
+		p.pos += len("null")
+		return NULL
+	}
+	return p.unexpected()
+}
+
+func (p *jsonParser) object() object.Object {
+	p.pos++ // {
+	m := object.NewMap()
+	p.skipSpace()
+	if p.consume('}') {
+		return m
+	}
+
+	for {
+		p.skipSpace()
+		if p.pos == len(p.input) || p.input[p.pos] != '"' {
+			return p.unexpected()
+		}
+		key, err := p.string()
+		if err != nil {
+			return err
+		}
+		p.skipSpace()
+		if !p.consume(':') {
+			return p.unexpected()
+		}
+		val := p.value()
+		if _, ok := val.(*object.Error); ok {
+			return val
+		}
+		m.Set(key, val)
+
+		p.skipSpace()
+		switch {
+		case p.consume(','):
+		case p.consume('}'):
+			return m
+		default:
+			return p.unexpected()
+		}
+	}
+}
+
+func (p *jsonParser) array() object.Object {
+	p.pos++ // [
+	elements := []object.Object{}
+	p.skipSpace()
+	if p.consume(']') {
+		return &object.Array{Elements: elements}
+	}
+
+	for {
+		val := p.value()
+		if _, ok := val.(*object.Error); ok {
+			return val
+		}
+		elements = append(elements, val)
+
+		p.skipSpace()
+		switch {
+		case p.consume(','):
+		case p.consume(']'):
+			return &object.Array{Elements: elements}
+		default:
+			return p.unexpected()
+		}
+	}
+}
+
+func (p *jsonParser) string() (string, *object.Error) {
+	p.pos++ // "
+	var out strings.Builder
+	for {
+		if p.pos == len(p.input) {
+			return "", p.unexpected()
+		}
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return out.String(), nil
+		case c < 0x20:
+			return "", p.unexpected()
+		case c != '\\':
+			out.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		p.pos++ // backslash
+		if p.pos == len(p.input) {
+			return "", p.unexpected()
+		}
+		switch c := p.input[p.pos]; c {
+		case '"', '\\', '/':
+			out.WriteByte(c)
+		case 'b':
+			out.WriteByte('\b')
+		case 'f':
+			out.WriteByte('\f')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'u':
+			r, ok := p.hex4(p.pos + 1)
+			if !ok {
+				return "", p.errorf("invalid escape \\%s", p.input[p.pos:min(p.pos+5, len(p.input))])
+			}
+			p.pos += 4
+			if utf16.IsSurrogate(r) {
+				if low, ok := p.hex4(p.pos + 3); ok && strings.HasPrefix(p.input[p.pos+1:], `\u`) {
+					if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+						r = pair
+						p.pos += 6
+					}
+				}
+			}
+			out.WriteRune(r)
+		default:
+			return "", p.errorf("invalid escape \\%c", c)
+		}
+		p.pos++
+	}
+}
+
+// hex4 decodes the four hex digits at pos.
+func (p *jsonParser) hex4(pos int) (rune, bool) {
+	if pos+4 > len(p.input) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(p.input[pos:pos+4], 16, 32)
+	return rune(n), err == nil
+}
+
+// number decodes a number, which is an integer unless it has a fraction,
+// an exponent or too many digits for one.
+func (p *jsonParser) number() object.Object {
+	start := p.pos
+	p.consume('-')
+	switch {
+	case p.consume('0'):
+	case p.digits() == 0:
+		return p.unexpected()
+	}
+
+	integral := true
+	if p.consume('.') {
+		integral = false
+		if p.digits() == 0 {
+			return p.unexpected()
+		}
+	}
+	if p.consume('e') || p.consume('E') {
+		integral = false
+		if !p.consume('+') {
+			p.consume('-')
+		}
+		if p.digits() == 0 {
+			return p.unexpected()
+		}
+	}
+
+	literal := p.input[start:p.pos]
+	if integral {
+		if n, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			return &object.Integer{Value: n}
+		}
+	}
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		p.pos = start
+		return p.errorf("number %s out of range", literal)
+	}
+	return &object.Float{Value: f}
+}
+
+func (p *jsonParser) digits() int {
+	n := 0
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+		n++
+	}
+	return n
+}
+
+func (p *jsonParser) consume(c byte) bool {
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.input) && strings.IndexByte(" \t\n\r", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *jsonParser) unexpected() *object.Error {
+	if p.pos == len(p.input) {
+		return p.errorf("unexpected end of input")
+	}
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return p.errorf("unexpected %q", r)
+}
+
+// errorf reports an error at the current position, counting lines from
+// newlines and columns in characters.
+func (p *jsonParser) errorf(format string, a ...interface{}) *object.Error {
+	consumed := p.input[:p.pos]
+	line := strings.Count(consumed, "\n") + 1
+	column := utf8.RuneCountInString(consumed[strings.LastIndexByte(consumed, '\n')+1:]) + 1
+	return newError("json_parse: %s at line %d, column %d", fmt.Sprintf(format, a...), line, column)
+}
+
+// JSON encoding
+
+// writeJSON writes obj at the given nesting depth. With an indent each
+// element goes on its own line, as with json.MarshalIndent.
+func writeJSON(out *bytes.Buffer, obj object.Object, indent string, depth int) *object.Error {
+	newline := func(depth int) {
+		if indent != "" {
+			out.WriteByte('\n')
+			out.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *object.Null:
+		out.WriteString("null")
+	case *object.Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+	case *object.Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *object.Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return newError("json_stringify: cannot encode %s", obj.Inspect())
+		}
+		// Keep integral floats floats when they are parsed again.
+		b, _ := json.Marshal(obj.Value)
+		if !bytes.ContainsAny(b, ".e") {
+			b = append(b, ".0"...)
+		}
+		out.Write(b)
+	case *object.String:
+		writeJSONString(out, obj.Value)
+	case *object.Array:
+		if len(obj.Elements) == 0 {
+			out.WriteString("[]")
+			return nil
+		}
+		out.WriteByte('[')
+		for i, el := range obj.Elements {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(depth + 1)
+			if err := writeJSON(out, el, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(depth)
+		out.WriteByte(']')
+	case *object.Map:
+		if obj.Len() == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		out.WriteByte('{')
+		for i, key := range obj.Keys() {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(depth + 1)
+			writeJSONString(out, key)
+			out.WriteByte(':')
+			if indent != "" {
+				out.WriteByte(' ')
+			}
+			val, _ := obj.Get(key)
+			if err := writeJSON(out, val, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(depth)
+		out.WriteByte('}')
+	case *object.Struct:
+		m := object.NewMap()
+		for i, field := range obj.StructType.Fields {
+			m.Set(field, obj.Values[i])
+		}
+		return writeJSON(out, m, indent, depth)
+	default:
+		return newError("json_stringify: cannot encode %s", obj.Type())
+	}
+	return nil
+}
+
+// writeJSONString quotes s, leaving HTML characters as they are.
+func writeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	out.Truncate(out.Len() - 1) // newline added by Encode
+}
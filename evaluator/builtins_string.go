@@ -0,0 +1,174 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRepeatLength bounds the strings `repeat` builds, so that a script
+// cannot exhaust memory with one call.
+const maxRepeatLength = 1 << 26
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:   "split",
+			params: []builtinParam{param("str", object.STRING_OBJ), param("sep", object.STRING_OBJ)},
+			doc:    "Returns the parts of str between each sep; an empty sep splits into characters.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				parts := strings.Split(stringArg(args[0]), stringArg(args[1]))
+				return stringArray(parts)
+			},
+		},
+		&builtinDefinition{
+			name:   "join",
+			params: []builtinParam{param("array", object.ARRAY_OBJ), param("sep", object.STRING_OBJ)},
+			doc:    "Returns the elements of array joined by sep.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				parts := []string{}
+				for _, el := range args[0].(*object.Array).Elements {
+					parts = append(parts, el.Inspect())
+				}
+				return &object.String{Value: strings.Join(parts, stringArg(args[1]))}
+			},
+		},
+		&builtinDefinition{
+			name:   "trim",
+			params: []builtinParam{param("str", object.STRING_OBJ)},
+			doc:    "Returns str without leading and trailing white space.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return &object.String{Value: strings.TrimSpace(stringArg(args[0]))}
+			},
+		},
+		&builtinDefinition{
+			name:   "upper",
+			params: []builtinParam{param("str", object.STRING_OBJ)},
+			doc:    "Returns str with all letters in upper case.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return &object.String{Value: strings.ToUpper(stringArg(args[0]))}
+			},
+		},
+		&builtinDefinition{
+			name:   "lower",
+			params: []builtinParam{param("str", object.STRING_OBJ)},
+			doc:    "Returns str with all letters in lower case.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return &object.String{Value: strings.ToLower(stringArg(args[0]))}
+			},
+		},
+		&builtinDefinition{
+			name:   "contains",
+			params: []builtinParam{param("haystack", object.STRING_OBJ, object.ARRAY_OBJ), param("needle")},
+			doc:    "Reports whether a string contains a substring or an array contains an element.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				if arr, ok := args[0].(*object.Array); ok {
+					for _, el := range arr.Elements {
+						if objectsEqual(el, args[1]) {
+							return TRUE
+						}
+					}
+					return FALSE
+				}
+
+				needle, ok := args[1].(*object.String)
+				if !ok {
+					return newError("argument `needle` to `contains` must be STRING, got %s", args[1].Type())
+				}
+				return nativeBoolToBooleanObject(strings.Contains(stringArg(args[0]), needle.Value))
+			},
+		},
+		&builtinDefinition{
+			name:   "starts_with",
+			params: []builtinParam{param("str", object.STRING_OBJ), param("prefix", object.STRING_OBJ)},
+			doc:    "Reports whether str begins with prefix.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return nativeBoolToBooleanObject(strings.HasPrefix(stringArg(args[0]), stringArg(args[1])))
+			},
+		},
+		&builtinDefinition{
+			name:   "ends_with",
+			params: []builtinParam{param("str", object.STRING_OBJ), param("suffix", object.STRING_OBJ)},
+			doc:    "Reports whether str ends with suffix.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return nativeBoolToBooleanObject(strings.HasSuffix(stringArg(args[0]), stringArg(args[1])))
+			},
+		},
+		&builtinDefinition{
+			name:   "replace",
+			params: []builtinParam{param("str", object.STRING_OBJ), param("old", object.STRING_OBJ), param("new", object.STRING_OBJ)},
+			doc:    "Returns str with every occurrence of old replaced by new.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return &object.String{Value: strings.ReplaceAll(stringArg(args[0]), stringArg(args[1]), stringArg(args[2]))}
+			},
+		},
+		&builtinDefinition{
+			name:   "repeat",
+			params: []builtinParam{param("str", object.STRING_OBJ), param("count", object.INTEGER_OBJ)},
+			doc:    "Returns count copies of str concatenated.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				count := args[1].(*object.Integer).Value
+				if count < 0 {
+					return newError("`repeat` count must not be negative, got %d", count)
+				}
+				str := stringArg(args[0])
+				// Dividing rather than multiplying cannot overflow.
+				if len(str) > 0 && count > maxRepeatLength/int64(len(str)) {
+					return newError("`repeat` result must not exceed %d bytes, got %d copies of %d", maxRepeatLength, count, len(str))
+				}
+				return &object.String{Value: strings.Repeat(str, int(count))}
+			},
+		},
+		&builtinDefinition{
+			name:     "substr",
+			params:   []builtinParam{param("str", object.STRING_OBJ), param("start", object.INTEGER_OBJ), param("length", object.INTEGER_OBJ)},
+			optional: 1,
+			doc:      "Returns up to length characters of str from start; negative start counts from the end.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				runes := []rune(stringArg(args[0]))
+				length := int64(len(runes))
+				start := clampIndex(args[1].(*object.Integer).Value, length)
+				end := length
+				if len(args) == 3 {
+					count := args[2].(*object.Integer).Value
+					if count < 0 {
+						return newError("`substr` length must not be negative, got %d", count)
+					}
+					if count < end-start {
+						end = start + count
+					}
+				}
+				return &object.String{Value: string(runes[start:end])}
+			},
+		},
+		&builtinDefinition{
+			name:   "chars",
+			params: []builtinParam{param("str", object.STRING_OBJ)},
+			doc:    "Returns an array of the characters of str.",
+			fn: func(env *object.Environment, args ...object.Object) object.Object {
+				chars := []string{}
+				for _, r := range stringArg(args[0]) {
+					chars = append(chars, string(r))
+				}
+				return stringArray(chars)
+			},
+		},
+	)
+}
+
+func stringArg(arg object.Object) string {
+	return arg.(*object.String).Value
+}
+
+func stringArray(values []string) *object.Array {
+	elements := make([]object.Object, len(values))
+	for i, v := range values {
+		elements[i] = &object.String{Value: v}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// runeIndex converts a byte offset in str into a character offset.
+func runeIndex(str string, byteIdx int) int {
+	return utf8.RuneCountInString(str[:byteIdx])
+}
@@ -20,7 +20,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Token: node.Token, Parameters: params, ParameterPatterns: node.ParameterPatterns, Env: env, Body: body}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
@@ -30,7 +30,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return applyFunction(function, args, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.PrefixExpression:
@@ -50,9 +50,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, env, nested)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return evalIfExpression(node, env, nested)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env, nested)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -60,11 +62,34 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
+		if env.Frozen() {
+			return newError("cannot bind %s: environment is frozen", letTarget(node))
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			if err := bindPattern(node.Pattern, val, env); err != nil {
+				return err
+			}
+			return nil
+		}
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			if _, isLiteral := node.Value.(*ast.FunctionLiteral); isLiteral {
+				fn.Name = node.Name.Value
+			}
+		}
 		env.Set(node.Name.Value, val)
+	case *ast.StructStatement:
+		if env.Frozen() {
+			return newError("cannot bind %s: environment is frozen", node.Name.Value)
+		}
+		fields := []string{}
+		for _, f := range node.Fields {
+			fields = append(fields, f.Value)
+		}
+		env.Set(node.Name.Value, &object.StructType{Name: node.Name.Value, Fields: fields})
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -86,6 +111,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.StructLiteral:
+		return evalStructLiteral(node, env)
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Member.Value)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
@@ -95,10 +130,21 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+// letTarget describes what a let statement binds, for error messages.
+func letTarget(node *ast.LetStatement) string {
+	if node.Pattern != nil {
+		return node.Pattern.String()
+	}
+	return node.Name.Value
+}
+
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
+		if err := traceStatement(statement, env); err != nil {
+			return err
+		}
 		result = Eval(statement, env)
 
 		switch result := result.(type) {
@@ -112,11 +158,68 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+// position records where a node sits relative to the body of the function
+// being evaluated, which decides whether a call there can be a tail call.
+type position int
+
+const (
+	nested    position = iota // the value feeds an enclosing expression
+	statement                 // a statement of the body; `return` leaves the function
+	tail                      // the value becomes the function's result
+)
+
+// evalPositioned evaluates node like Eval, except that a call in tail
+// position is returned as a *tailCall for applyFunction to perform.
+func evalPositioned(node ast.Node, env *object.Environment, pos position) object.Object {
+	if pos == nested {
+		return Eval(node, env)
+	}
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env, pos)
+	case *ast.ExpressionStatement:
+		return evalPositioned(node.Expression, env, pos)
+	case *ast.ReturnStatement:
+		val := evalPositioned(node.ReturnValue, env, tail)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.IfExpression:
+		return evalIfExpression(node, env, pos)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env, pos)
+	case *ast.CallExpression:
+		if pos != tail {
+			break
+		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return &tailCall{fn: function, args: args, env: env}
+	}
+
+	return Eval(node, env)
+}
+
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment, pos position) object.Object {
 	var result object.Object
 
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+	for i, stmt := range block.Statements {
+		stmtPos := pos
+		if pos == tail && i < len(block.Statements)-1 {
+			stmtPos = statement
+		}
+		if err := traceStatement(stmt, env); err != nil {
+			return err
+		}
+		result = evalPositioned(stmt, env, stmtPos)
 
 		if result != nil {
 			rt := result.Type()
@@ -129,31 +232,112 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
-	case *object.Builtin:
-		return fn.Fn(args...)
-	default:
-		return newError("not a function: %s", fn.Type())
+// traceStatement reports stmt to the evaluation's Tracer, if any.
+func traceStatement(stmt ast.Statement, env *object.Environment) *object.Error {
+	if tracer := env.Context().Tracer; tracer != nil {
+		return tracer.Statement(stmt, env)
+	}
+	return nil
+}
+
+// traceBranch reports the branch an if expression takes to the evaluation's
+// Tracer, if it is a BranchTracer.
+func traceBranch(ifExp *ast.IfExpression, consequence bool, env *object.Environment) {
+	if tracer, ok := env.Context().Tracer.(object.BranchTracer); ok {
+		tracer.Branch(ifExp, consequence)
 	}
 }
 
+// tailCall is a call in tail position. Instead of nesting another Eval on
+// the Go stack, it is handed back to applyFunction, which performs it in a
+// loop once the calling function's body has finished. It never escapes the
+// evaluator.
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+	env  *object.Environment
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+func applyFunction(fn object.Object, args []object.Object, caller *object.Environment) object.Object {
+	for {
+		var result object.Object
+
+		switch fn := fn.(type) {
+		case *object.Function:
+			if len(args) != len(fn.Parameters) {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), len(fn.Parameters))
+			}
+			extendedEnv, err := extendFunctionEnv(fn, args)
+			if err != nil {
+				return err
+			}
+			extendedEnv.SetContext(caller.Context())
+			tracer := caller.Context().Tracer
+			if tracer != nil {
+				tracer.Call(fn, extendedEnv)
+			}
+			result = unwrapReturnValue(evalBlockStatement(fn.Body, extendedEnv, tail))
+			if tracer != nil {
+				traceReturn(tracer, fn, result)
+			}
+		case *object.Builtin:
+			tracer := caller.Context().Tracer
+			if tracer == nil {
+				return fn.Fn(caller, args...)
+			}
+			tracer.Call(fn, caller)
+			result := fn.Fn(caller, args...)
+			tracer.Return(fn, result)
+			return result
+		case *object.StructType:
+			if len(args) != len(fn.Fields) {
+				return newError("wrong number of arguments. got=%d, want=%d", len(args), len(fn.Fields))
+			}
+			return &object.Struct{StructType: fn, Values: args}
+		default:
+			return newError("not a function: %s", fn.Type())
+		}
+
+		call, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+		fn, args, caller = call.fn, call.args, call.env
+	}
+}
+
+// traceReturn reports the end of a call of fn to tracer. A function whose
+// frame is replaced by a tail call returns nothing of its own.
+func traceReturn(tracer object.Tracer, fn object.Object, result object.Object) {
+	switch result.(type) {
+	case *tailCall:
+		result = nil
+	case nil:
+		result = NULL
+	}
+	tracer.Return(fn, result)
+}
+
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+) (*object.Environment, *object.Error) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
+		if paramIdx < len(fn.ParameterPatterns) && fn.ParameterPatterns[paramIdx] != nil {
+			if err := bindPattern(fn.ParameterPatterns[paramIdx], args[paramIdx], env); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		env.Set(param.Value, args[paramIdx])
 	}
 
-	return env
-
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -202,6 +386,8 @@ func evalInfixExpression(
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -213,21 +399,105 @@ func evalInfixExpression(
 	}
 }
 
-func evalIfExpression(ifExp *ast.IfExpression, env *object.Environment) object.Object {
+func evalIfExpression(ifExp *ast.IfExpression, env *object.Environment, pos position) object.Object {
 	condition := Eval(ifExp.Condition, env)
 
 	if isError(condition) {
 		return condition
 	}
+	traceBranch(ifExp, isTruthy(condition), env)
 	if isTruthy(condition) {
-		return Eval(ifExp.Consequence, env)
+		return evalPositioned(ifExp.Consequence, env, pos)
 	} else if ifExp.Alternative != nil {
-		return Eval(ifExp.Alternative, env)
+		return evalPositioned(ifExp.Alternative, env, pos)
 	} else {
 		return NULL
 	}
 }
 
+func evalMatchExpression(match *ast.MatchExpression, env *object.Environment, pos position) object.Object {
+	subject := Eval(match.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range match.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+		if !matchPattern(arm.Pattern, subject, armEnv) {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return evalPositioned(arm.Body, armEnv, pos)
+	}
+
+	return newError("no match arm matched value: %s", subject.Inspect())
+}
+
+// matchPattern reports whether value matches pattern, binding any names the
+// pattern introduces in env.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) bool {
+	return bindPattern(pattern, value, env) == nil
+}
+
+// bindPattern destructures value according to pattern, binding the names it
+// introduces in env. It returns an error describing the first place where
+// the value does not have the shape the pattern requires.
+func bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+		return nil
+	case *ast.LiteralPattern:
+		if !objectsEqual(Eval(pattern.Value, env), value) {
+			return newError("cannot destructure %s: expected %s", value.Inspect(), pattern.String())
+		}
+		return nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return newError("cannot destructure %s into %s", value.Type(), pattern.String())
+		}
+
+		count := len(pattern.Elements)
+		if pattern.Rest == nil && len(array.Elements) != count {
+			return newError("cannot destructure array of length %d into %s: want exactly %d elements",
+				len(array.Elements), pattern.String(), count)
+		}
+		if len(array.Elements) < count {
+			return newError("cannot destructure array of length %d into %s: want at least %d elements",
+				len(array.Elements), pattern.String(), count)
+		}
+
+		for i, el := range pattern.Elements {
+			if err := bindPattern(el, array.Elements[i], env); err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-count)
+			copy(rest, array.Elements[count:])
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+
+		return nil
+	}
+
+	return newError("unsupported pattern: %s", pattern.String())
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -258,6 +528,10 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.MAP_OBJ && index.Type() == object.STRING_OBJ:
+		return evalMapIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -268,6 +542,9 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
+	if idx < 0 {
+		idx += max + 1
+	}
 	if idx < 0 || idx > max {
 		return NULL
 	}
@@ -275,6 +552,188 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	max := int64(len(runes) - 1)
+
+	if idx < 0 {
+		idx += max + 1
+	}
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+func evalMapIndexExpression(m, key object.Object) object.Object {
+	if val, ok := m.(*object.Map).Get(key.(*object.String).Value); ok {
+		return val
+	}
+
+	return NULL
+}
+
+// evalStructLiteral builds a struct from a struct type, which needs a value
+// for every field, or copies a struct, replacing the fields given.
+func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.Object {
+	left := Eval(node.Struct, env)
+	if isError(left) {
+		return left
+	}
+
+	var st *object.StructType
+	var values []object.Object
+	switch left := left.(type) {
+	case *object.StructType:
+		st = left
+		values = make([]object.Object, len(st.Fields))
+	case *object.Struct:
+		st = left.StructType
+		values = append([]object.Object{}, left.Values...)
+	default:
+		return newError("struct literal not supported: %s", left.Type())
+	}
+
+	for i, field := range node.Fields {
+		idx := st.Index(field.Value)
+		if idx < 0 {
+			return newError("unknown field %s in struct %s", field.Value, st.Name)
+		}
+		val := Eval(node.Values[i], env)
+		if isError(val) {
+			return val
+		}
+		values[idx] = val
+	}
+	for i, val := range values {
+		if val == nil {
+			return newError("missing field %s in struct %s", st.Fields[i], st.Name)
+		}
+	}
+
+	return &object.Struct{StructType: st, Values: values}
+}
+
+func evalMemberExpression(obj object.Object, member string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Struct:
+		if val, ok := obj.Get(member); ok {
+			return val
+		}
+		return newError("unknown field %s in struct %s", member, obj.StructType.Name)
+	case *object.Map:
+		if val, ok := obj.Get(member); ok {
+			return val
+		}
+		return NULL
+	default:
+		return newError("member access not supported: %s", obj.Type())
+	}
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	bounds := [3]*int64{}
+	for i, exp := range []ast.Expression{node.Start, node.End, node.Step} {
+		if exp == nil {
+			continue
+		}
+		bound := Eval(exp, env)
+		if isError(bound) {
+			return bound
+		}
+		integer, ok := bound.(*object.Integer)
+		if !ok {
+			return newError("slice bounds must be INTEGER, got %s", bound.Type())
+		}
+		bounds[i] = &integer.Value
+	}
+
+	step := int64(1)
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+	if step == 0 {
+		return newError("slice step cannot be zero")
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		indices := sliceIndices(int64(len(left.Elements)), bounds[0], bounds[1], step)
+		elements := make([]object.Object, len(indices))
+		for i, idx := range indices {
+			elements[i] = left.Elements[idx]
+		}
+		return &object.Array{Elements: elements}
+	case *object.String:
+		runes := []rune(left.Value)
+		indices := sliceIndices(int64(len(runes)), bounds[0], bounds[1], step)
+		sliced := make([]rune, len(indices))
+		for i, idx := range indices {
+			sliced[i] = runes[idx]
+		}
+		return &object.String{Value: string(sliced)}
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// sliceIndices resolves Python-style slice bounds against a sequence of the
+// given length. Missing bounds default to the whole sequence in the direction
+// of step, and negative bounds count from the end.
+func sliceIndices(length int64, start, end *int64, step int64) []int64 {
+	lower, upper := int64(0), length
+	if step < 0 {
+		lower, upper = -1, length-1
+	}
+
+	resolve := func(bound *int64, fallback int64) int64 {
+		if bound == nil {
+			return fallback
+		}
+		idx := *bound
+		if idx < 0 {
+			idx += length
+			if idx < lower {
+				idx = lower
+			}
+		} else if idx > upper {
+			idx = upper
+		}
+		return idx
+	}
+
+	var from, to int64
+	if step > 0 {
+		from, to = resolve(start, lower), resolve(end, upper)
+	} else {
+		from, to = resolve(start, upper), resolve(end, lower)
+	}
+
+	// Counting the indices up front, rather than stepping past to, keeps
+	// huge steps from overflowing. from and to are within the sequence, so
+	// their difference cannot overflow.
+	var count int64
+	switch {
+	case step > 0 && from < to:
+		count = (to-from-1)/step + 1
+	case step < 0 && from > to:
+		count = (to-from+1)/step + 1
+	}
+
+	indices := make([]int64, count)
+	for i := range indices {
+		indices[i] = from + int64(i)*step
+	}
+	return indices
+}
+
 func evalIntegerInfixExpression(
 	operator string, 
 	left, right object.Object,
@@ -304,6 +763,48 @@ func evalIntegerInfixExpression(
 	}
 }
 
+// evalFloatInfixExpression evaluates operations on two numbers of which at
+// least one is a float, converting the other to a float if need be.
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := floatValue(left)
+	rightVal := floatValue(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func floatValue(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 
 	switch right {
@@ -319,6 +820,9 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if float, ok := right.(*object.Float); ok {
+		return &object.Float{Value: -float.Value}
+	}
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
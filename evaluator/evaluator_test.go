@@ -1,10 +1,15 @@
 package evaluator
 
 import (
+	"bytes"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -379,6 +384,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -430,7 +443,17 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len(1)`, "argument `value` to `len` must be STRING or ARRAY or MAP, got INTEGER"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2])`, 1},
+		{`first(1)`, "argument `array` to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2])`, 2},
+		{`push(1, 1)`, "argument `array` to `push` must be ARRAY, got INTEGER"},
+		{`push([])`, "wrong number of arguments. got=1, want=2"},
+		{`format()`, "wrong number of arguments. got=0, want at least 1"},
+		{`slice([1], 0, 1, 2)`, "wrong number of arguments. got=4, want=2 to 3"},
+		{`slice([1], "a")`, "argument `start` to `slice` must be INTEGER, got STRING"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
 
@@ -453,6 +476,719 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestOutputBuiltins(t *testing.T) {
+	tests := []struct {
+		input string
+		expectedOutput string
+	}{
+		{`puts("hello")`, "hello\n"},
+		{`puts(1, true, [1, 2])`, "1\ntrue\n[1, 2]\n"},
+		{`print("a", 1); print("b")`, "a 1b"},
+		{`let f = fn(x) { puts(x * 2) }; f(21);`, "42\n"},
+		{`puts(format("%d items in %s (%t) 100%%", 3, "cart", true))`, "3 items in cart (true) 100%\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		env := object.NewEnvironment()
+		env.SetOutput(&out)
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, env)
+		testNullObject(t, evaluated)
+
+		if out.String() != tt.expectedOutput {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expectedOutput, out.String())
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{`format("%d", "a")`, "format verb %d expects INTEGER, got STRING"},
+		{`format("%d %d", 1)`, "missing argument for %d in format string"},
+		{`format("%d", 1, 2)`, "too many arguments for format string. got=2, want=1"},
+		{`format("%x", 1)`, "unknown format verb %x"},
+		{`format(1)`, "argument `format` to `format` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestEnclosedEnvironmentOutput(t *testing.T) {
+	var outerOut, innerOut bytes.Buffer
+	outer := object.NewEnvironment()
+	outer.SetOutput(&outerOut)
+	sibling := object.NewEnclosedEnvironment(outer)
+	inner := object.NewEnclosedEnvironment(outer)
+	inner.SetOutput(&innerOut)
+
+	Eval(parser.New(lexer.New(`puts("inner")`)).ParseProgram(), inner)
+	Eval(parser.New(lexer.New(`puts("outer")`)).ParseProgram(), outer)
+	Eval(parser.New(lexer.New(`puts("sibling")`)).ParseProgram(), sibling)
+
+	if innerOut.String() != "inner\n" || outerOut.String() != "outer\nsibling\n" {
+		t.Errorf("got inner output %q and outer output %q, want %q and %q",
+			innerOut.String(), outerOut.String(), "inner\n", "outer\nsibling\n")
+	}
+}
+
+func TestOutputFollowsCaller(t *testing.T) {
+	library := object.NewEnvironment()
+	Eval(parser.New(lexer.New(`let greet = fn(name) { puts("hi " + name) };`)).ParseProgram(), library)
+
+	var out bytes.Buffer
+	env := object.NewEnclosedEnvironment(library)
+	env.SetContext(&object.Context{Out: &out})
+	Eval(parser.New(lexer.New(`greet("bob")`)).ParseProgram(), env)
+
+	if out.String() != "hi bob\n" {
+		t.Errorf("output not written to caller's writer. got=%q", out.String())
+	}
+}
+
+func TestInputBuiltins(t *testing.T) {
+	tests := []struct {
+		input string
+		stdin string
+		expected interface{}
+	}{
+		{`readline()`, "first\nsecond\n", "first"},
+		{`readline(); readline()`, "first\r\nsecond", "second"},
+		{`readline(); readline()`, "first\n", nil},
+		{`readline()`, "", nil},
+		{`readline(); read_all()`, "a\nb\nc\n", "b\nc\n"},
+		{`read_all(); read_all()`, "a\n", nil},
+		{`let it = lines(); next(it); next(it)`, "a\nb\n", "b"},
+		{`let it = lines(); next(it); next(it)`, "a\n", nil},
+		{`let it = lines(); readline(); next(it)`, "a\nb\n", "b"},
+		{`next(1)`, "", "argument `iterator` to `next` must be ITERATOR, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetInput(strings.NewReader(tt.stdin))
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, env)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("%q: wrong value. expected=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], 5, fn(acc, x) { acc + x })`, "5"},
+		{`find([1, 5, 10], fn(x) { x > 3 })`, "5"},
+		{`find([1, 2], fn(x) { x > 3 })`, "null"},
+		{`any([1, 2, 3], fn(x) { x == 2 })`, "true"},
+		{`any([], fn(x) { true })`, "false"},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort_by([[2, "b"], [1, "a"], [2, "a"]], fn(p) { p[0] })`, "[[1, a], [2, b], [2, a]]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`flatten([1, [2, [3, 4]], [], 5])`, "[1, 2, 3, 4, 5]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2, 3, 4], 3, 1)`, "[]"},
+		{`index_of([1, [2], "a"], [2])`, "1"},
+		{`index_of([1, 2], 3)`, "-1"},
+		{`let xs = [1, 2, 3]; map(xs, fn(x) { x + 1 }); xs`, "[1, 2, 3]"},
+		{`map([1, 2], len)`, "ERROR: argument `value` to `len` must be STRING or ARRAY or MAP, got INTEGER"},
+		{`map([1, 2], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`filter([1, 2], fn(x, y) { x })`, "ERROR: wrong number of arguments. got=1, want=2"},
+		{`map(1, fn(x) { x })`, "ERROR: argument `collection` to `map` must be ARRAY or ITERATOR, got INTEGER"},
+		{`map([1], 1)`, "ERROR: argument `fn` to `map` must be FUNCTION or BUILTIN, got INTEGER"},
+		{`sort([1, "a"])`, "ERROR: `sort` cannot compare INTEGER and STRING"},
+		{`sort([true])`, "ERROR: `sort` cannot order BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%q: no result", tt.input)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHigherOrderBuiltinsOnIterators(t *testing.T) {
+	env := object.NewEnvironment()
+	env.SetInput(strings.NewReader("a\nbb\nccc\ndddd\n"))
+
+	input := `let it = lines(); let long = find(it, fn(l) { len(l) > 1 }); [long, map(it, len)]`
+	evaluated := Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	if evaluated.Inspect() != "[bb, [3, 4]]" {
+		t.Errorf("iterator not consumed lazily. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestBuiltinHelp(t *testing.T) {
+	tests := []struct {
+		name string
+		expected string
+	}{
+		{"len", "len(value: STRING | ARRAY | MAP)\n    Returns the number of characters in a string, elements in an array or keys in a map."},
+		{"slice", "slice(seq: ARRAY | STRING, start: INTEGER, end?: INTEGER)\n    Returns the elements or characters from start up to end; negative bounds count from the end."},
+		{"puts", "puts(values...: ANY)\n    Writes each value to the output on its own line and returns null."},
+	}
+
+	for _, tt := range tests {
+		help, ok := BuiltinHelp(tt.name)
+		if !ok {
+			t.Errorf("no help for %s", tt.name)
+			continue
+		}
+		if help != tt.expected {
+			t.Errorf("wrong help for %s. expected=%q, got=%q", tt.name, tt.expected, help)
+		}
+	}
+
+	for _, name := range BuiltinNames() {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("documented builtin %s is not registered", name)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("héé", "")`, "[h, é, é]"},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, 2], ", ")`, "1, 2"},
+		{`join([], ",")`, ""},
+		{"trim(\"  \tpadded\n \")", "padded"},
+		{`upper("déjà vu")`, "DÉJÀ VU"},
+		{`lower("ÀB")`, "àb"},
+		{`contains("seafood", "foo")`, "true"},
+		{`contains("seafood", "bar")`, "false"},
+		{`contains([1, 2], 2)`, "true"},
+		{`contains("a", 1)`, "ERROR: argument `needle` to `contains` must be STRING, got INTEGER"},
+		{`starts_with("golang", "go")`, "true"},
+		{`ends_with("golang", "go")`, "false"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, "ERROR: `repeat` count must not be negative, got -1"},
+		{`repeat("ab", 9223372036854775807)`, "ERROR: `repeat` result must not exceed 67108864 bytes, got 9223372036854775807 copies of 2"},
+		{`repeat("ab", 33554433)`, "ERROR: `repeat` result must not exceed 67108864 bytes, got 33554433 copies of 2"},
+		{`len(repeat("ab", 33554432))`, "67108864"},
+		{`repeat("", 9223372036854775807)`, ""},
+		{`substr("héllo", 1, 3)`, "éll"},
+		{`substr("héllo", -2)`, "lo"},
+		{`substr("héllo", 3, 10)`, "lo"},
+		{`substr("abc", 1, 9223372036854775807)`, "bc"},
+		{`index_of("日本語だ", "語")`, "2"},
+		{`index_of("abc", "z")`, "-1"},
+		{`chars("日本")`, "[日, 本]"},
+		{`len("日本語")`, "3"},
+		{`slice("日本語だ", 1, 3)`, "本語"},
+		{`slice("abc", -1)`, "c"},
+		{`"日本語"[1]`, "本"},
+		{`"abc"[0]`, "a"},
+		{`"abc"[3]`, "null"},
+		{`upper(1)`, "ERROR: argument `str` to `upper` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		json string
+		input string
+		expected string
+	}{
+		{`{"b": [1, 2.5, -3e2], "a": {"x": null, "y": true}}`, "json", "{b: [1, 2.5, -300.0], a: {x: null, y: true}}"},
+		{`{"b": 1, "a": 2}`, "keys(json)", "[b, a]"},
+		{`{"n": 1, "n": 2}`, "json", "{n: 2}"},
+		{`{"price": 2.5}`, `json["price"] * 2`, "5.0"},
+		{`{"price": 2.5}`, `json["missing"]`, "null"},
+		{`{"a": [1, {"b": 2}]}`, `json["a"][1]["b"] + len(json)`, "3"},
+		{`"tab\there \u00e9 \ud83d\ude00"`, "json", "tab\there é 😀"},
+		{`92233720368547758070`, "json", "9.223372036854776e+19"},
+		{`[1, 2] == [1, 2]`, "json_parse(json)", "ERROR: json_parse: unexpected '=' at line 1, column 8"},
+		{"{\n  \"a\": 1,\n  \"b\" 2\n}", "json", "ERROR: json_parse: unexpected '2' at line 3, column 7"},
+		{`[1, 2`, "json", "ERROR: json_parse: unexpected end of input at line 1, column 6"},
+		{`{"a": 01}`, "json", "ERROR: json_parse: unexpected '1' at line 1, column 8"},
+		{`"\x"`, "json", "ERROR: json_parse: invalid escape \\x at line 1, column 3"},
+		{strings.Repeat("[", 1000) + strings.Repeat("]", 1000), "len(json)", "1"},
+		{strings.Repeat(`{"a": [`, 500) + "]" + strings.Repeat("}]", 499) + "}", "len(json)", "1"},
+		{strings.Repeat("[", 1001), "json", "ERROR: json_parse: nesting too deep at line 1, column 1001"},
+		{strings.Repeat("[", 500000), "json", "ERROR: json_parse: nesting too deep at line 1, column 1001"},
+		{`{"a": [1, 2.5, "<é>"], "b": {}, "c": []}`, "json_stringify(json)", `{"a":[1,2.5,"<é>"],"b":{},"c":[]}`},
+		{`{"a": [1, 2], "b": {"c": null}}`, "json_stringify(json, 2)", "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {\n    \"c\": null\n  }\n}"},
+		{`[1.0, true]`, `json_stringify(json, "--")`, "[\n--1.0,\n--true\n]"},
+		{`[]`, "json_stringify(fn(x) { x })", "ERROR: json_stringify: cannot encode FUNCTION"},
+		{`[]`, "json_stringify(json, -1)", "ERROR: `json_stringify` indent must be between 0 and 10, got -1"},
+		{`[]`, "json_stringify(json, 11)", "ERROR: `json_stringify` indent must be between 0 and 10, got 11"},
+		{`[]`, "json_stringify(json, 9223372036854775807)", "ERROR: `json_stringify` indent must be between 0 and 10, got 9223372036854775807"},
+		{`[1]`, "json_stringify(json, 10)", "[\n          1\n]"},
+		{`{"a": [1, 2.5, "s"], "b": 3.0}`, "assert_eq(json_parse(json_stringify(json, 4)), json)", "null"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		json := parseJSON(tt.json)
+		if tt.input == "json_parse(json)" {
+			json = &object.String{Value: tt.json}
+		}
+		env.Set("json", json)
+
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s with json = %s: expected=%q, got=%q", tt.input, tt.json, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-2]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][1::2]", "[2, 4]"},
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][3:0:-1]", "[4, 3, 2]"},
+		{"[1, 2, 3, 4, 5][-1:-3:-1]", "[5, 4]"},
+		{"[1, 2, 3][10:]", "[]"},
+		{"[1, 2, 3][-10:2]", "[1, 2]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"let i = 1; [1, 2, 3][i:i + 1]", "[2]"},
+		{`"héllo wörld"[6:]`, "wörld"},
+		{`"héllo"[::-1]`, "olléh"},
+		{`"héllo"[-1]`, "o"},
+		{`"abc"[1:9223372036854775807:9223372036854775807]`, "b"},
+		{`"abc"[-9223372036854775807:9223372036854775807:9223372036854775807]`, "a"},
+		{`"abc"[9223372036854775807:-9223372036854775807:-9223372036854775807]`, "c"},
+		{"[1, 2, 3][::-9223372036854775807 - 1]", "[3]"},
+		{"[1, 2, 3][-9223372036854775807 - 1:9223372036854775807]", "[1, 2, 3]"},
+		{"[1, 2, 3][9223372036854775807:-9223372036854775807 - 1:-1]", "[3, 2, 1]"},
+		{"[][9223372036854775807:-9223372036854775807:-9223372036854775807]", "[]"},
+		{"[1, 2, 3][::0]", "ERROR: slice step cannot be zero"},
+		{`[1, 2, 3]["a":]`, "ERROR: slice bounds must be INTEGER, got STRING"},
+		{"1[1:]", "ERROR: slice operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{`match (1) { 1 => "one", _ => "other" }`, "one"},
+		{`match (2) { 1 => "one", _ => "other" }`, "other"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, "2"},
+		{`match (-1) { -1 => "neg", _ => "pos" }`, "neg"},
+		{`match (1 > 2) { true => "yes", false => "no" }`, "no"},
+		{`match (5) { n => n * 2 }`, "10"},
+		{`match (15) { x if x > 10 => "big", x => "small" }`, "big"},
+		{`match (5) { x if x > 10 => "big", x => "small" }`, "small"},
+		{`match ([]) { [] => "empty", _ => "full" }`, "empty"},
+		{`match ([1, 2, 3]) { [h, ...t] => [h, t] }`, "[1, [2, 3]]"},
+		{`match ([1]) { [h, ...t] => t }`, "[]"},
+		{`match ([1, 2]) { [a] => "one", [a, b] => a + b }`, "3"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`match ([1, 2, 3]) { [1, ..._] => "starts with 1" }`, "starts with 1"},
+		{`match ("s") { [h, ...t] => h, _ => "not an array" }`, "not an array"},
+		{`let sum = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + sum(t) } }; sum([1, 2, 3, 4])`, "10"},
+		{`let f = fn(x) { match (x) { 1 => { return "early"; }, _ => "late" }; "after" }; f(1)`, "early"},
+		{`let x = 1; match (2) { x => x }; x`, "1"},
+		{`match (3) { 1 => "one", 2 => "two" }`, "ERROR: no match arm matched value: 3"},
+		{`match (1) { x if x + true => 1 }`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`match (1 + true) { _ => 1 }`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"let [a, b] = [1, 2]; a + b", "3"},
+		{"let [h, ...t] = [1, 2, 3]; t", "[2, 3]"},
+		{"let [h, ...t] = [1]; t", "[]"},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", "6"},
+		{"let [_, b] = [1, 2]; b", "2"},
+		{"let [x, y]: [int] = [3, 4]; x * y", "12"},
+		{"let add = fn([a, b]) { a + b }; add([1, 2])", "3"},
+		{"let f = fn(x, [a, ...rest]) { x + a + len(rest) }; f(1, [10, 20, 30])", "13"},
+		{"map([[1, 2], [3, 4]], fn([a, b]) { a * b })", "[2, 12]"},
+		{"let [a, b] = 1;", "ERROR: cannot destructure INTEGER into [a, b]"},
+		{"let [a, b] = [1, 2, 3];", "ERROR: cannot destructure array of length 3 into [a, b]: want exactly 2 elements"},
+		{"let [a, b, ...c] = [1];", "ERROR: cannot destructure array of length 1 into [a, b, ...c]: want at least 2 elements"},
+		{"let [a, [b, c]] = [1, 2];", "ERROR: cannot destructure INTEGER into [b, c]"},
+		{"let [1, a] = [2, 3];", "ERROR: cannot destructure 2: expected 1"},
+		{"let f = fn([a, b]) { a }; f([1]);", "ERROR: cannot destructure array of length 1 into [a, b]: want exactly 2 elements"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"struct Point { x, y } Point", "struct Point { x, y }"},
+		{"struct Point { x, y } Point(1, 2)", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y } Point{y: 2, x: 1}", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y } let p = Point(1, 2); p.x + p.y", "3"},
+		{"struct Point { x, y } let p = Point(1, 2); let q = p{x: 10}; [p, q]", "[Point{x: 1, y: 2}, Point{x: 10, y: 2}]"},
+		{"struct Point { x, y } Point(1, 2){y: 5}.y", "5"},
+		{"struct Line { from, to } struct Point { x, y } Line(Point(0, 0), Point(3, 4)).to.y", "4"},
+		{`struct User { name, tags } User("ann", ["a", "b"]).tags[1]`, "b"},
+		{"struct Empty {} Empty()", "Empty{}"},
+		{"struct Point { x, y } let move = fn(p, dx) { p{x: p.x + dx} }; move(Point(1, 2), 3)", "Point{x: 4, y: 2}"},
+		{"struct Point { x, y } map([1, 2], fn(n) { Point(n, n * n) })", "[Point{x: 1, y: 1}, Point{x: 2, y: 4}]"},
+		{"struct Point { x, y } assert_eq(Point(1, [2]), Point(1, [2]))", "null"},
+		{`json_stringify(json_parse(json).a)`, "[1,2]"},
+		{"struct Point { x, y } json_stringify(Point(1, true))", `{"x":1,"y":true}`},
+		{"struct Point { x, y } Point(1)", "ERROR: wrong number of arguments. got=1, want=2"},
+		{"struct Point { x, y } Point{x: 1}", "ERROR: missing field y in struct Point"},
+		{"struct Point { x, y } Point{x: 1, y: 2, z: 3}", "ERROR: unknown field z in struct Point"},
+		{"struct Point { x, y } Point(1, 2){z: 3}", "ERROR: unknown field z in struct Point"},
+		{"struct Point { x, y } Point(1, 2).z", "ERROR: unknown field z in struct Point"},
+		{"struct Point { x, y } Point{x: 1, y: 1 + true}", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"5.x", "ERROR: member access not supported: INTEGER"},
+		{"[1]{x: 1}", "ERROR: struct literal not supported: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("json", &object.String{Value: `{"a": [1, 2]}`})
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// Recursing this deep without tail calls needs far more than 16MB of Go stack.
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(1000000)", "0"},
+		{"let countdown = fn(n) { if (n == 0) { return 0; } countdown(n - 1) }; countdown(100000)", "0"},
+		{"let countdown = fn(n) { if (n > 0) { return countdown(n - 1); } \"done\" }; countdown(100000)", "done"},
+		{"let sum = fn(n, acc) { match (n) { 0 => acc, _ => sum(n - 1, acc + n) } }; sum(100000, 0)", "5000050000"},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)", "false"},
+		{"let loop = fn(n) { if (n == 0) { len(\"done\") } else { loop(n - 1) } }; loop(100000)", "4"},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)", "3628800"},
+		{"let f = fn(n) { if (n == 0) { f(1); \"first\" } else { \"second\" } }; f(0)", "first"},
+		{"let f = fn(n) { let x = if (n > 0) { n } else { 0 }; x }; f(3)", "3"},
+		{"let f = fn(n) { if (n == 0) { g() } else { f(n - 1) } }; f(10)", "ERROR: identifier not found: g"},
+		{"let f = fn(n) { if (n == 0) { 1 + true } else { f(n - 1) } }; f(10)", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(n) { f(n, n) }; f(1)", "ERROR: wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConcurrencyBuiltins(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"await(spawn(fn() { 1 + 2 }))", "3"},
+		{"let square = fn(x) { x * x }; let tasks = map([1, 2, 3], fn(x) { spawn(fn() { square(x) }) }); map(tasks, await)", "[1, 4, 9]"},
+		{"let t = spawn(fn() { 42 }); [await(t), await(t)]", "[42, 42]"},
+		{"await(spawn(fn() { }))", "null"},
+		{"let ch = channel(); spawn(fn() { send(ch, \"ping\") }); recv(ch)", "ping"},
+		{"let ch = channel(2); send(ch, 1); send(ch, 2); close(ch); [recv(ch), recv(ch), recv(ch)]", "[1, 2, null]"},
+		{`
+		let ch = channel();
+		let produce = fn(n) { if (n > 0) { send(ch, n); produce(n - 1) } else { close(ch) } };
+		spawn(fn() { produce(100) });
+		let total = fn(acc) { let v = recv(ch); if (v) { total(acc + v) } else { acc } };
+		total(0)
+		`, "5050"},
+		{`
+		let results = channel(10);
+		let workers = map([1, 2, 3, 4, 5], fn(i) { spawn(fn() { send(results, i * 10) }) });
+		each(workers, await);
+		close(results);
+		let drain = fn(acc) { let v = recv(results); if (v) { drain(acc + v) } else { acc } };
+		drain(0)
+		`, "150"},
+		{"await(spawn(fn() { 1 + true }))", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"let t = spawn(fn() { missing }); let r = await(t); 1", "ERROR: identifier not found: missing"},
+		{"let ch = channel(); close(ch); send(ch, 1)", "ERROR: send on closed channel"},
+		{"let ch = channel(); close(ch); close(ch)", "ERROR: close of closed channel"},
+		{"channel(-1)", "ERROR: `channel` capacity must not be negative, got -1"},
+		{"spawn(1)", "ERROR: argument `fn` to `spawn` must be FUNCTION or BUILTIN, got INTEGER"},
+		{"await(1)", "ERROR: argument `task` to `await` must be TASK, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSpawnedTasksShareOutput(t *testing.T) {
+	input := `
+	let tasks = map([1, 2, 3, 4], fn(i) { spawn(fn() { puts(i) }) });
+	each(tasks, await);
+	`
+
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetOutput(&out)
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	lines := strings.Fields(out.String())
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines of output, got=%q", out.String())
+	}
+}
+
+// The concurrency tests below are most useful under `go test -race`.
+
+func TestCloseWakesBlockedSender(t *testing.T) {
+	ch := object.NewChannel(0)
+	sent := make(chan bool)
+	go func() { sent <- ch.Send(&object.Integer{Value: 1}) }()
+
+	// Give the sender time to block; the outcome is the same if it has not.
+	time.Sleep(10 * time.Millisecond)
+	if !ch.Close() {
+		t.Fatalf("Close of an open channel reported false")
+	}
+	select {
+	case ok := <-sent:
+		if ok {
+			t.Errorf("Send on a channel closed while it blocked reported true")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Send still blocked after Close")
+	}
+	if val, ok := ch.Receive(); ok {
+		t.Errorf("Receive on a closed, empty channel returned %v", val)
+	}
+}
+
+func TestConcurrentEvaluation(t *testing.T) {
+	input := `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	let xs = map([1, 2, 3, 4, 5], fn(x) { fib(x) * 2 });
+	puts(join(xs, ","), !true, len("héllo"));
+	reduce(xs, 0, fn(acc, x) { acc + x })
+	`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var out bytes.Buffer
+			env := object.NewEnvironment()
+			env.SetOutput(&out)
+
+			evaluated := Eval(program, env)
+			if evaluated.Inspect() != "24" {
+				t.Errorf("wrong result. got=%q", evaluated.Inspect())
+			}
+			if out.String() != "2,2,4,6,10\nfalse\n5\n" {
+				t.Errorf("wrong output. got=%q", out.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSharedFrozenEnvironment(t *testing.T) {
+	library := `
+	let greeting = "hello";
+	let greet = fn(name) { puts(greeting + " " + name); name };
+	let twice = fn(f, x) { f(f(x)) };
+	`
+	base := object.NewEnvironment()
+	Eval(parser.New(lexer.New(library)).ParseProgram(), base)
+	base.Freeze()
+
+	names := []string{"ann", "bob", "cy", "dee", "eve", "fay", "gus", "hal"}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			var out bytes.Buffer
+			env := object.NewEnvironmentFrom(base)
+			env.SetOutput(&out)
+
+			input := `let name = "` + name + `"; let greeting = "shadowed"; twice(greet, name)`
+			evaluated := Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+			if evaluated.Inspect() != name {
+				t.Errorf("wrong result. got=%q", evaluated.Inspect())
+			}
+
+			expected := "hello " + name + "\nhello " + name + "\n"
+			if out.String() != expected {
+				t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	if greeting, _ := base.Get("greeting"); greeting.Inspect() != "hello" {
+		t.Errorf("frozen environment was modified. greeting=%q", greeting.Inspect())
+	}
+}
+
+func TestFrozenEnvironmentRejectsBindings(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Freeze()
+
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"let x = 1;", "ERROR: cannot bind x: environment is frozen"},
+		{"let [a, b] = [1, 2];", "ERROR: cannot bind [a, b]: environment is frozen"},
+		{"let f = fn(x) { let y = x; y }; 1", "ERROR: cannot bind f: environment is frozen"},
+		{"fn(x) { let y = x * 2; y }(21)", "42"},
+	}
+
+	for _, tt := range tests {
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	result := env.Set("x", &object.Integer{Value: 1})
+	if err, ok := result.(*object.Error); !ok || err.Message != "cannot bind x: environment is frozen" {
+		t.Errorf("Set on a frozen environment returned %v, want an error", result)
+	}
+	if _, ok := env.Get("x"); ok {
+		t.Errorf("Set bound x in a frozen environment")
+	}
+
+	outer := object.NewEnvironment()
+	inner := object.NewEnclosedEnvironment(outer)
+	inner.Freeze()
+	if !outer.Frozen() {
+		t.Errorf("Freeze did not freeze the enclosing environment")
+	}
+}
+
+func TestAssertBuiltins(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{`assert(1 < 2)`, "null"},
+		{`assert(1 > 2)`, "ERROR: assertion failed"},
+		{`assert(false, "math is broken")`, "ERROR: assertion failed: math is broken"},
+		{`assert_eq([1, 2], [1, 2])`, "null"},
+		{`assert_eq([1, 2, 4], [1, 2, 3])`, "ERROR: assert_eq failed\ngot:  [1, 2, 4]\nwant: [1, 2, 3]\n             ^"},
+		{`assert_eq("日本", "日b")`, "ERROR: assert_eq failed\ngot:  日本\nwant: 日b\n       ^"},
+		{`assert_eq("café", "cafè")`, "ERROR: assert_eq failed\ngot:  café\nwant: cafè\n         ^"},
+		{`assert_eq("1", 1)`, "ERROR: assert_eq failed\ngot:  1 (STRING)\nwant: 1 (INTEGER)"},
+		{`assert_eq(fn(x) { x }, fn(x) { x + 1 })`, "ERROR: assert_eq failed\n- want\n+ got\n  fn(x) {\n- (x + 1)\n+ x\n  }"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -0,0 +1,467 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	defineBuiltins(
+		&builtinDefinition{
+			name:   "map",
+			params: []builtinParam{param("collection", collectionType...), param("fn", callableTypes...)},
+			doc:    "Returns an array of fn applied to each element.",
+			fn:     builtinMap,
+		},
+		&builtinDefinition{
+			name:   "filter",
+			params: []builtinParam{param("collection", collectionType...), param("fn", callableTypes...)},
+			doc:    "Returns an array of the elements for which fn returns a truthy value.",
+			fn:     builtinFilter,
+		},
+		&builtinDefinition{
+			name:   "reduce",
+			params: []builtinParam{param("collection", collectionType...), param("initial"), param("fn", callableTypes...)},
+			doc:    "Folds the elements into an accumulator, starting from initial, with fn(acc, element).",
+			fn:     builtinReduce,
+		},
+		&builtinDefinition{
+			name:   "each",
+			params: []builtinParam{param("collection", collectionType...), param("fn", callableTypes...)},
+			doc:    "Calls fn with each element and returns null.",
+			fn:     builtinEach,
+		},
+		&builtinDefinition{
+			name:   "find",
+			params: []builtinParam{param("collection", collectionType...), param("fn", callableTypes...)},
+			doc:    "Returns the first element for which fn returns a truthy value, or null.",
+			fn:     builtinFind,
+		},
+		&builtinDefinition{
+			name:   "any",
+			params: []builtinParam{param("collection", collectionType...), param("fn", callableTypes...)},
+			doc:    "Reports whether fn returns a truthy value for some element.",
+			fn:     builtinAny,
+		},
+		&builtinDefinition{
+			name:   "all",
+			params: []builtinParam{param("collection", collectionType...), param("fn", callableTypes...)},
+			doc:    "Reports whether fn returns a truthy value for every element.",
+			fn:     builtinAll,
+		},
+		&builtinDefinition{
+			name:   "sort",
+			params: []builtinParam{param("array", object.ARRAY_OBJ)},
+			doc:    "Returns the integers or strings of an array in ascending order.",
+			fn:     builtinSort,
+		},
+		&builtinDefinition{
+			name:   "sort_by",
+			params: []builtinParam{param("array", object.ARRAY_OBJ), param("fn", callableTypes...)},
+			doc:    "Returns the elements stably ordered by the integer or string key fn(element).",
+			fn:     builtinSortBy,
+		},
+		&builtinDefinition{
+			name:   "reverse",
+			params: []builtinParam{param("array", object.ARRAY_OBJ)},
+			doc:    "Returns the elements of an array in reverse order.",
+			fn:     builtinReverse,
+		},
+		&builtinDefinition{
+			name:   "zip",
+			params: []builtinParam{param("left", object.ARRAY_OBJ), param("right", object.ARRAY_OBJ)},
+			doc:    "Returns an array of [left, right] pairs, as long as the shorter input.",
+			fn:     builtinZip,
+		},
+		&builtinDefinition{
+			name:   "flatten",
+			params: []builtinParam{param("array", object.ARRAY_OBJ)},
+			doc:    "Returns the elements of an array with nested arrays spliced in recursively.",
+			fn:     builtinFlatten,
+		},
+		&builtinDefinition{
+			name:     "slice",
+			params:   []builtinParam{param("seq", object.ARRAY_OBJ, object.STRING_OBJ), param("start", object.INTEGER_OBJ), param("end", object.INTEGER_OBJ)},
+			optional: 1,
+			doc:      "Returns the elements or characters from start up to end; negative bounds count from the end.",
+			fn:       builtinSlice,
+		},
+		&builtinDefinition{
+			name:   "index_of",
+			params: []builtinParam{param("seq", object.ARRAY_OBJ, object.STRING_OBJ), param("value")},
+			doc:    "Returns the index of the first element equal to value, or of the first occurrence of a substring, or -1.",
+			fn:     builtinIndexOf,
+		},
+	)
+}
+
+func builtinMap(env *object.Environment, args ...object.Object) object.Object {
+	result := []object.Object{}
+	stopped := iterate(args[0], func(el object.Object) object.Object {
+		mapped := callback(args[1], []object.Object{el}, env)
+		if isError(mapped) {
+			return mapped
+		}
+		result = append(result, mapped)
+		return nil
+	})
+	if stopped != nil {
+		return stopped
+	}
+
+	return &object.Array{Elements: result}
+}
+
+func builtinFilter(env *object.Environment, args ...object.Object) object.Object {
+	result := []object.Object{}
+	stopped := iterate(args[0], func(el object.Object) object.Object {
+		keep := callback(args[1], []object.Object{el}, env)
+		if isError(keep) {
+			return keep
+		}
+		if isTruthy(keep) {
+			result = append(result, el)
+		}
+		return nil
+	})
+	if stopped != nil {
+		return stopped
+	}
+
+	return &object.Array{Elements: result}
+}
+
+func builtinReduce(env *object.Environment, args ...object.Object) object.Object {
+	acc := args[1]
+	stopped := iterate(args[0], func(el object.Object) object.Object {
+		acc = callback(args[2], []object.Object{acc, el}, env)
+		if isError(acc) {
+			return acc
+		}
+		return nil
+	})
+	if stopped != nil {
+		return stopped
+	}
+
+	return acc
+}
+
+func builtinEach(env *object.Environment, args ...object.Object) object.Object {
+	stopped := iterate(args[0], func(el object.Object) object.Object {
+		if result := callback(args[1], []object.Object{el}, env); isError(result) {
+			return result
+		}
+		return nil
+	})
+	if stopped != nil {
+		return stopped
+	}
+
+	return NULL
+}
+
+func builtinFind(env *object.Environment, args ...object.Object) object.Object {
+	found := iterate(args[0], func(el object.Object) object.Object {
+		matched := callback(args[1], []object.Object{el}, env)
+		if isError(matched) {
+			return matched
+		}
+		if isTruthy(matched) {
+			return el
+		}
+		return nil
+	})
+	if found != nil {
+		return found
+	}
+
+	return NULL
+}
+
+func builtinAny(env *object.Environment, args ...object.Object) object.Object {
+	found := iterate(args[0], func(el object.Object) object.Object {
+		matched := callback(args[1], []object.Object{el}, env)
+		if isError(matched) {
+			return matched
+		}
+		if isTruthy(matched) {
+			return TRUE
+		}
+		return nil
+	})
+	if found != nil {
+		return found
+	}
+
+	return FALSE
+}
+
+func builtinAll(env *object.Environment, args ...object.Object) object.Object {
+	found := iterate(args[0], func(el object.Object) object.Object {
+		matched := callback(args[1], []object.Object{el}, env)
+		if isError(matched) {
+			return matched
+		}
+		if !isTruthy(matched) {
+			return FALSE
+		}
+		return nil
+	})
+	if found != nil {
+		return found
+	}
+
+	return TRUE
+}
+
+func builtinSort(env *object.Environment, args ...object.Object) object.Object {
+	elements := args[0].(*object.Array).Elements
+	return sortByKeys("sort", elements, elements)
+}
+
+func builtinSortBy(env *object.Environment, args ...object.Object) object.Object {
+	elements := args[0].(*object.Array).Elements
+	keys := make([]object.Object, len(elements))
+	for i, el := range elements {
+		keys[i] = callback(args[1], []object.Object{el}, env)
+		if isError(keys[i]) {
+			return keys[i]
+		}
+	}
+
+	return sortByKeys("sort_by", elements, keys)
+}
+
+func builtinReverse(env *object.Environment, args ...object.Object) object.Object {
+	elements := args[0].(*object.Array).Elements
+	length := len(elements)
+	reversed := make([]object.Object, length)
+	for i, el := range elements {
+		reversed[length-1-i] = el
+	}
+
+	return &object.Array{Elements: reversed}
+}
+
+func builtinZip(env *object.Environment, args ...object.Object) object.Object {
+	left := args[0].(*object.Array).Elements
+	right := args[1].(*object.Array).Elements
+	length := len(left)
+	if len(right) < length {
+		length = len(right)
+	}
+
+	pairs := make([]object.Object, length)
+	for i := 0; i < length; i++ {
+		pairs[i] = &object.Array{Elements: []object.Object{left[i], right[i]}}
+	}
+
+	return &object.Array{Elements: pairs}
+}
+
+func builtinFlatten(env *object.Environment, args ...object.Object) object.Object {
+	return &object.Array{Elements: flattenInto([]object.Object{}, args[0].(*object.Array))}
+}
+
+func flattenInto(result []object.Object, array *object.Array) []object.Object {
+	for _, el := range array.Elements {
+		if nested, ok := el.(*object.Array); ok {
+			result = flattenInto(result, nested)
+		} else {
+			result = append(result, el)
+		}
+	}
+	return result
+}
+
+func builtinSlice(env *object.Environment, args ...object.Object) object.Object {
+	var length int64
+	switch seq := args[0].(type) {
+	case *object.String:
+		length = int64(utf8.RuneCountInString(seq.Value))
+	case *object.Array:
+		length = int64(len(seq.Elements))
+	}
+
+	start := clampIndex(args[1].(*object.Integer).Value, length)
+	end := length
+	if len(args) == 3 {
+		end = clampIndex(args[2].(*object.Integer).Value, length)
+	}
+	if end < start {
+		end = start
+	}
+
+	if str, ok := args[0].(*object.String); ok {
+		return &object.String{Value: string([]rune(str.Value)[start:end])}
+	}
+
+	sliced := make([]object.Object, end-start)
+	copy(sliced, args[0].(*object.Array).Elements[start:end])
+	return &object.Array{Elements: sliced}
+}
+
+// clampIndex resolves a possibly negative index counted from the end and
+// clamps it to [0, length].
+func clampIndex(idx, length int64) int64 {
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 {
+		return 0
+	}
+	if idx > length {
+		return length
+	}
+	return idx
+}
+
+func builtinIndexOf(env *object.Environment, args ...object.Object) object.Object {
+	if str, ok := args[0].(*object.String); ok {
+		sub, ok := args[1].(*object.String)
+		if !ok {
+			return newError("argument `value` to `index_of` must be STRING, got %s", args[1].Type())
+		}
+		byteIdx := strings.Index(str.Value, sub.Value)
+		if byteIdx < 0 {
+			return &object.Integer{Value: -1}
+		}
+		return &object.Integer{Value: int64(runeIndex(str.Value, byteIdx))}
+	}
+
+	for i, el := range args[0].(*object.Array).Elements {
+		if objectsEqual(el, args[1]) {
+			return &object.Integer{Value: int64(i)}
+		}
+	}
+
+	return &object.Integer{Value: -1}
+}
+
+// callback applies a user-supplied function, treating a body that produced
+// no value as NULL.
+func callback(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	if result := applyFunction(fn, args, env); result != nil {
+		return result
+	}
+	return NULL
+}
+
+// iterate calls visit with each element of an array or iterator until visit
+// returns a non-nil object, which iterate then returns. Iterators are only
+// advanced as far as needed.
+func iterate(collection object.Object, visit func(el object.Object) object.Object) object.Object {
+	switch collection := collection.(type) {
+	case *object.Array:
+		for _, el := range collection.Elements {
+			if result := visit(el); result != nil {
+				return result
+			}
+		}
+	case *object.Iterator:
+		for {
+			el, ok := collection.Next()
+			if !ok {
+				break
+			}
+			if result := visit(el); result != nil {
+				return result
+			}
+		}
+	}
+	return nil
+}
+
+// sortByKeys returns elements stably ordered by keys, which must be all
+// integers or all strings.
+func sortByKeys(name string, elements, keys []object.Object) object.Object {
+	for _, key := range keys {
+		if key.Type() != keys[0].Type() {
+			return newError("`%s` cannot compare %s and %s", name, keys[0].Type(), key.Type())
+		}
+		if key.Type() != object.INTEGER_OBJ && key.Type() != object.STRING_OBJ {
+			return newError("`%s` cannot order %s", name, key.Type())
+		}
+	}
+
+	order := make([]int, len(elements))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		switch left := keys[order[i]].(type) {
+		case *object.Integer:
+			return left.Value < keys[order[j]].(*object.Integer).Value
+		case *object.String:
+			return left.Value < keys[order[j]].(*object.String).Value
+		}
+		return false
+	})
+
+	sorted := make([]object.Object, len(elements))
+	for i, idx := range order {
+		sorted[i] = elements[idx]
+	}
+
+	return &object.Array{Elements: sorted}
+}
+
+// objectsEqual compares values structurally: numbers, strings and booleans
+// by value, arrays element by element, maps key by key in any order and
+// everything else by identity.
+func objectsEqual(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		other, ok := b.(*object.Integer)
+		return ok && a.Value == other.Value
+	case *object.String:
+		other, ok := b.(*object.String)
+		return ok && a.Value == other.Value
+	case *object.Boolean:
+		other, ok := b.(*object.Boolean)
+		return ok && a.Value == other.Value
+	case *object.Float:
+		other, ok := b.(*object.Float)
+		return ok && a.Value == other.Value
+	case *object.Array:
+		other, ok := b.(*object.Array)
+		if !ok || len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !objectsEqual(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Map:
+		other, ok := b.(*object.Map)
+		if !ok || a.Len() != other.Len() {
+			return false
+		}
+		for _, key := range a.Keys() {
+			val, _ := a.Get(key)
+			otherVal, ok := other.Get(key)
+			if !ok || !objectsEqual(val, otherVal) {
+				return false
+			}
+		}
+		return true
+	case *object.Struct:
+		other, ok := b.(*object.Struct)
+		if !ok || a.StructType != other.StructType {
+			return false
+		}
+		for i := range a.Values {
+			if !objectsEqual(a.Values[i], other.Values[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -1,45 +1,86 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input string
 	position int
 	readPosition int
-	ch byte
+	ch rune
+	line int
+	column int
+	errors []string
 }
 
 func New(input string) *Lexer {
-	lexerInst := &Lexer{input: input}
+	lexerInst := &Lexer{input: input, line: 1}
 	lexerInst.readChar()
 	return lexerInst
 }
 
+// Tokenize returns every token in input, ending with EOF.
+func Tokenize(input string) []token.Token {
+	lexer := New(input)
+	tokens := []token.Token{}
+	for {
+		tok := lexer.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
 func (lexer *Lexer) readChar() {
+	if lexer.ch == '\n' {
+		lexer.line++
+		lexer.column = 0
+	}
+	lexer.column++
+
+	width := 0
 	if lexer.readPosition >= len(lexer.input) {
 		lexer.ch = 0
 	} else {
-		lexer.ch = lexer.input[lexer.readPosition]
+		lexer.ch, width = utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
+		if lexer.ch == utf8.RuneError && width == 1 {
+			msg := fmt.Sprintf("%d:%d: invalid UTF-8 encoding", lexer.line, lexer.column)
+			lexer.errors = append(lexer.errors, msg)
+		}
 	}
 
 	lexer.position = lexer.readPosition
-	lexer.readPosition++
+	lexer.readPosition += width
+	if width == 0 {
+		lexer.readPosition++
+	}
 }
 
-func (lexer *Lexer) peekChar() byte {
+func (lexer *Lexer) peekChar() rune {
 	if lexer.readPosition >= len(lexer.input) {
 		return 0
 	} else {
-		return lexer.input[lexer.readPosition]
+		ch, _ := utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
+		return ch
 	}
 }
 
+// Errors returns the positioned problems found in the input so far, such as
+// invalid UTF-8 sequences.
+func (lexer *Lexer) Errors() []string {
+	return lexer.errors
+}
+
 func (lexer *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	lexer.skipWhitespace()
+	line, column := lexer.line, lexer.column
 
 	switch lexer.ch {
 	case '=':
@@ -48,6 +89,9 @@ func (lexer *Lexer) NextToken() token.Token {
 			lexer.readChar()
 			literal := string(ch) + string(lexer.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if '>' == lexer.peekChar() {
+			lexer.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, lexer.ch)
 		}
@@ -63,6 +107,20 @@ func (lexer *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, lexer.ch)
 	case ',':
 		tok = newToken(token.COMMA, lexer.ch)
+	case ':':
+		tok = newToken(token.COLON, lexer.ch)
+	case '.':
+		if '.' == lexer.peekChar() {
+			lexer.readChar()
+			if '.' == lexer.peekChar() {
+				lexer.readChar()
+				tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+			} else {
+				tok = token.Token{Type: token.ILLEGAL, Literal: ".."}
+			}
+		} else {
+			tok = newToken(token.DOT, lexer.ch)
+		}
 	case '+':
 		tok = newToken(token.PLUS, lexer.ch)
 	case '-':
@@ -98,16 +156,19 @@ func (lexer *Lexer) NextToken() token.Token {
 		if isLetter(lexer.ch) {
 			tok.Literal = lexer.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(lexer.ch) {
 			tok.Type = token.INT
 			tok.Literal = lexer.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, lexer.ch)
 		}
 	}
 	lexer.readChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
@@ -119,7 +180,7 @@ func (lexer *Lexer) readNumber() string {
 	return lexer.input[position:lexer.position]
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
@@ -149,10 +210,10 @@ func (lexer *Lexer) readString() string {
 	return lexer.input[position:lexer.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
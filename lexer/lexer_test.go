@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"bytes"
 	"testing"
 	"monkey/token"
 )
@@ -135,3 +136,180 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedLine int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.SEMICOLON, 2, 11},
+		{token.EOF, 2, 12},
+	}
+
+	lexerUnderTest := New(input)
+
+	for i, tt := range tests {
+		tok := lexerUnderTest.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+						i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	input := `let größe = "日本語"; π_x + naïve;`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedLiteral string
+		expectedColumn int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "日本語", 13},
+		{token.SEMICOLON, ";", 18},
+		{token.IDENT, "π_x", 20},
+		{token.PLUS, "+", 24},
+		{token.IDENT, "naïve", 26},
+		{token.SEMICOLON, ";", 31},
+		{token.EOF, "", 32},
+	}
+
+	lexerUnderTest := New(input)
+
+	for i, tt := range tests {
+		tok := lexerUnderTest.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+						i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+		}
+	}
+
+	if len(lexerUnderTest.Errors()) != 0 {
+		t.Fatalf("unexpected lexer errors: %v", lexerUnderTest.Errors())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	input := "let x = 1;\nlet \xff = \"a\xc3\";"
+
+	lexerUnderTest := New(input)
+	types := []token.TokenType{}
+	for tok := lexerUnderTest.NextToken(); tok.Type != token.EOF; tok = lexerUnderTest.NextToken() {
+		types = append(types, tok.Type)
+	}
+
+	if types[6] != token.ILLEGAL {
+		t.Errorf("invalid byte not lexed as ILLEGAL. got=%q", types[6])
+	}
+
+	expected := []string{
+		"2:5: invalid UTF-8 encoding",
+		"2:11: invalid UTF-8 encoding",
+	}
+	errors := lexerUnderTest.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%v, got=%v", expected, errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i])
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	input := `match (x) { [h, ...t] if h => 1, _ => 2 } .. .`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "h"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "t"},
+		{token.RBRACKET, "]"},
+		{token.IF, "if"},
+		{token.IDENT, "h"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "2"},
+		{token.RBRACE, "}"},
+		{token.ILLEGAL, ".."},
+		{token.DOT, "."},
+		{token.EOF, ""},
+	}
+
+	lexerUnderTest := New(input)
+
+	for i, tt := range tests {
+		tok := lexerUnderTest.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+						i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("let x = 5;\nx")
+
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 1, Column: 5},
+		{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 7},
+		{Type: token.INT, Literal: "5", Line: 1, Column: 9},
+		{Type: token.SEMICOLON, Literal: ";", Line: 1, Column: 10},
+		{Type: token.IDENT, Literal: "x", Line: 2, Column: 1},
+		{Type: token.EOF, Literal: "", Line: 2, Column: 2},
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. expected=%d, got=%d (%v)", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok != expected[i] {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, expected[i], tok)
+		}
+	}
+
+	var out bytes.Buffer
+	token.WriteTable(&out, tokens[:2])
+	table := "POS  TYPE   LITERAL\n1:1  LET    \"let\"\n1:5  IDENT  \"x\"\n"
+	if out.String() != table {
+		t.Errorf("wrong table. expected=%q, got=%q", table, out.String())
+	}
+}
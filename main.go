@@ -7,7 +7,30 @@ import (
 	"monkey/repl"
 )
 
+const USAGE = `usage: monkey              start the REPL
+       monkey run FILE     evaluate FILE, reading input from stdin
+       monkey build [-O] FILE [-o OUT]
+                           compile FILE to OUT, by default FILE with .mkc
+                           for .mk, which monkey run loads without parsing
+       monkey ast [--format=json|dot] FILE
+                           print the syntax tree of FILE
+       monkey tokens [--format=table|json] FILE
+                           print the tokens of FILE
+       monkey profile [--pprof=OUT] FILE
+                           run FILE and report time spent per function
+       monkey cover [--coverprofile=OUT] [--html=OUT] FILE
+                           run FILE and report statement and branch coverage
+       monkey test [-v] [PATH...]
+                           run the test_ functions in *_test.mk files
+       monkey dap [--listen ADDR]
+                           serve the Debug Adapter Protocol on stdio or ADDR
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err !=  nil {
 		panic(err)
@@ -16,3 +39,31 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+func runCommand(command string, args []string) int {
+	switch command {
+	case "run":
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, USAGE)
+			return 2
+		}
+		return runFile(args[0])
+	case "build":
+		return buildFile(args)
+	case "ast":
+		return dumpAST(args)
+	case "tokens":
+		return dumpTokens(args)
+	case "profile":
+		return profileFile(args)
+	case "cover":
+		return coverFile(args)
+	case "test":
+		return runTests(args)
+	case "dap":
+		return serveDebugger(args)
+	default:
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+}
@@ -1,31 +1,195 @@
 package object
 
+import (
+	"bufio"
+	"io"
+	"monkey/ast"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Context holds per-evaluation settings. Unlike bindings it follows the call
+// stack rather than lexical scope, so a function defined in one environment
+// writes to the output of whichever evaluation calls it.
+//
+// Spawned tasks share their parent's input, output and lock; hold the lock
+// while using Out or In.
+type Context struct {
+	mu sync.Mutex
+	lockOwner *Context // set on untraced copies, which lock their original
+	Out io.Writer
+	In *bufio.Reader
+	Tracer Tracer
+}
+
+// Tracer observes an evaluation, for example to drive a debugger. Statement
+// is called before each statement runs; returning an error aborts the
+// evaluation with it. Call and Return bracket every call of a function or
+// builtin; Return gets a nil result when the function's frame is replaced
+// by a tail call, which is then reported as a call of its own. Spawned
+// tasks are not traced.
+type Tracer interface {
+	Statement(stmt ast.Statement, env *Environment) *Error
+	Call(fn Object, env *Environment)
+	Return(fn Object, result Object)
+}
+
+// BranchTracer is a Tracer that is also told which way each if expression
+// goes: consequence is false when the alternative, or the missing one, is
+// taken.
+type BranchTracer interface {
+	Tracer
+	Branch(expr *ast.IfExpression, consequence bool)
+}
+
+// Untraced returns a copy of ctx that shares its input, output and lock but
+// has no Tracer.
+func (ctx *Context) Untraced() *Context {
+	return &Context{lockOwner: ctx.lockContext(), Out: ctx.Out, In: ctx.In}
+}
+
+func (ctx *Context) Lock() { ctx.lockContext().mu.Lock() }
+func (ctx *Context) Unlock() { ctx.lockContext().mu.Unlock() }
+
+func (ctx *Context) lockContext() *Context {
+	if ctx.lockOwner != nil {
+		return ctx.lockOwner
+	}
+	return ctx
+}
+
+// Environment is safe for concurrent use, so spawned tasks may share the
+// scopes their functions close over. A frozen environment is read-only and
+// is read without locking.
 type Environment struct {
+	mu sync.RWMutex
 	store map[string]Object
 	outer *Environment
+	context *Context
+	frozen atomic.Bool
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, context: outer.context}
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, context: newContext()}
+}
+
+// NewEnvironmentFrom returns an empty top-level environment whose lookups
+// fall back to base, typically a frozen environment holding a preloaded
+// library. Unlike an enclosed environment it gets its own Context, so
+// evaluations that share base do not share output or input.
+func NewEnvironmentFrom(base *Environment) *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: base, context: newContext()}
+}
+
+func newContext() *Context {
+	return &Context{Out: io.Discard, In: bufio.NewReader(strings.NewReader(""))}
 }
 
 func (env *Environment) Get(name string) (Object, bool) {
-	obj, ok := env.store[name]
+	var obj Object
+	var ok bool
+	if env.frozen.Load() {
+		obj, ok = env.store[name]
+	} else {
+		env.mu.RLock()
+		obj, ok = env.store[name]
+		env.mu.RUnlock()
+	}
 	if !ok && env.outer != nil {
 		obj, ok = env.outer.Get(name)
 	}
 	return obj, ok
 }
 
+// Set binds name to val in env and returns val, or an Error if env is
+// frozen.
 func (env *Environment) Set(name string, val Object) Object {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+
+	if env.frozen.Load() {
+		return &Error{Message: "cannot bind " + name + ": environment is frozen"}
+	}
 	env.store[name] = val
 	return val
 }
 
+// Outer returns the environment env encloses, or nil for a top-level one.
+func (env *Environment) Outer() *Environment {
+	return env.outer
+}
+
+// Names lists the names bound directly in env, in alphabetical order.
+func (env *Environment) Names() []string {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+
+	names := make([]string, 0, len(env.store))
+	for name := range env.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Freeze makes env and the environments enclosing it read-only, so they
+// can be shared between goroutines without locking. Evaluate programs in
+// NewEnvironmentFrom(env) rather than in env itself.
+func (env *Environment) Freeze() {
+	for e := env; e != nil; e = e.outer {
+		e.mu.Lock()
+		e.frozen.Store(true)
+		e.mu.Unlock()
+	}
+}
+
+func (env *Environment) Frozen() bool {
+	return env.frozen.Load()
+}
+
+func (env *Environment) Context() *Context {
+	return env.context
+}
+
+func (env *Environment) SetContext(ctx *Context) {
+	env.context = ctx
+}
+
+// SetOutput directs output builtins such as `puts` to out for every
+// evaluation that uses env. An enclosed environment gets a Context of its
+// own first, so the environment it encloses keeps its output.
+func (env *Environment) SetOutput(out io.Writer) {
+	env.ownContext().Out = out
+}
+
+// SetInput makes input builtins such as `readline` read from in. Like
+// SetOutput it leaves the environment env encloses alone.
+func (env *Environment) SetInput(in io.Reader) {
+	env.ownContext().In = bufio.NewReader(in)
+}
+
+// SetTracer makes t observe every evaluation that uses env. Like SetOutput
+// it leaves the environment env encloses alone.
+func (env *Environment) SetTracer(t Tracer) {
+	env.ownContext().Tracer = t
+}
+
+// ownContext copies the Context env shares with the environment it
+// encloses, if it does, so that changing it affects env alone. The copy
+// keeps sharing the original's lock, as it may share its input or output.
+func (env *Environment) ownContext() *Context {
+	if env.outer != nil && env.context == env.outer.context {
+		ctx := env.context
+		env.context = &Context{lockOwner: ctx.lockContext(), Out: ctx.Out, In: ctx.In, Tracer: ctx.Tracer}
+	}
+	return env.context
+}
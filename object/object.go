@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"monkey/ast"
+	"monkey/token"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -17,6 +20,13 @@ const (
 	STRING_OBJ = "STRING"
 	BUILTIN_OBJ = "BUILTIN"
 	ARRAY_OBJ = "ARRAY"
+	ITERATOR_OBJ = "ITERATOR"
+	TASK_OBJ = "TASK"
+	CHANNEL_OBJ = "CHANNEL"
+	FLOAT_OBJ = "FLOAT"
+	MAP_OBJ = "MAP"
+	STRUCT_TYPE_OBJ = "STRUCT_TYPE"
+	STRUCT_OBJ = "STRUCT"
 )
 
 type ObjectType string
@@ -40,21 +50,87 @@ type Boolean struct {
 	Value bool
 }
 
+type Float struct {
+	Value float64
+}
+
 type Array struct {
 	Elements []Object
 }
 
-type BuiltinFunction func(args ...Object) Object
+// Map maps strings to values and remembers the order its keys were first
+// set in. Maps are built before scripts see them: Set must not be called
+// concurrently with other methods.
+type Map struct {
+	keys []string
+	values map[string]Object
+}
+
+func NewMap() *Map {
+	return &Map{values: map[string]Object{}}
+}
+
+// StructType is declared by a struct statement. Calling it, or following it
+// with a struct literal, builds a Struct.
+type StructType struct {
+	Name string
+	Fields []string
+}
+
+// Struct is a value of a StructType, holding one value per field in the
+// order the fields were declared. Structs are never changed once built:
+// updating a field makes a copy.
+type Struct struct {
+	StructType *StructType
+	Values []Object
+}
+
+type BuiltinFunction func(env *Environment, args ...Object) Object
 type Builtin struct {
+	Name string
 	Fn BuiltinFunction
 }
 
+// Iterator produces values lazily. Next reports false once it is exhausted.
+type Iterator struct {
+	Next func() (Object, bool)
+}
+
+// Task is a function running on its own goroutine. Done is closed once
+// Result holds the value, or error, the function produced.
+type Task struct {
+	Done chan struct{}
+	Result Object
+}
+
+// Channel passes values between tasks. Unlike a Go channel, sending on or
+// closing a closed Channel reports failure instead of panicking.
+//
+// values is never closed, so that senders cannot panic; closing closes done
+// instead, which wakes blocked senders and receivers.
+type Channel struct {
+	values chan Object
+	done chan struct{}
+	mu sync.Mutex
+	closed bool
+}
+
+func NewChannel(capacity int) *Channel {
+	return &Channel{values: make(chan Object, capacity), done: make(chan struct{})}
+}
+
 type ReturnValue struct {
 	Value Object
 }
 
+// Function is a closure. Token is the `fn` token of its definition and Name
+// the let binding it was defined in, if any; both identify the function in
+// debuggers and profiles.
 type Function struct {
+	Token token.Token
+	Name string
 	Parameters []*ast.Identifier
+	ParameterPatterns []*ast.ArrayPattern
 	Body *ast.BlockStatement
 	Env *Environment
 }
@@ -77,6 +153,19 @@ func (str *String) Type() ObjectType { return STRING_OBJ }
 func (boolean *Boolean) Inspect() string { return fmt.Sprintf("%t", boolean.Value) }
 func (boolean *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
+// Float functions
+func (float *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always shows a decimal point or exponent, so that floats with
+// integral values can be told apart from integers.
+func (float *Float) Inspect() string {
+	s := strconv.FormatFloat(float.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 // Array functions
 func (array *Array) Type() ObjectType { return ARRAY_OBJ }
 func (array *Array) Inspect() string {
@@ -94,10 +183,152 @@ func (array *Array) Inspect() string {
 	return out.String()
 }
 
+// Map functions
+func (m *Map) Type() ObjectType { return MAP_OBJ }
+func (m *Map) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, key := range m.keys {
+		pairs = append(pairs, key+": "+m.values[key].Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (m *Map) Get(key string) (Object, bool) {
+	val, ok := m.values[key]
+	return val, ok
+}
+
+// Set binds key to val, keeping the position of a key already present.
+func (m *Map) Set(key string, val Object) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = val
+}
+
+// Keys lists the keys in order.
+func (m *Map) Keys() []string {
+	return append([]string{}, m.keys...)
+}
+
+func (m *Map) Len() int { return len(m.keys) }
+
+// Struct type functions
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	if len(st.Fields) == 0 {
+		return "struct " + st.Name + " {}"
+	}
+	return "struct " + st.Name + " { " + strings.Join(st.Fields, ", ") + " }"
+}
+
+// Index returns the position of field, or -1 if st has no such field.
+func (st *StructType) Index(field string) int {
+	for i, f := range st.Fields {
+		if f == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// Struct functions
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for i, f := range s.StructType.Fields {
+		fields = append(fields, f+": "+s.Values[i].Inspect())
+	}
+
+	out.WriteString(s.StructType.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (s *Struct) Get(field string) (Object, bool) {
+	if i := s.StructType.Index(field); i >= 0 {
+		return s.Values[i], true
+	}
+	return nil, false
+}
+
 // Built-in type functions
 func (builtIn *Builtin) Inspect() string { return "builtin function" }
 func (builtIn *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 
+// Iterator functions
+func (iter *Iterator) Inspect() string { return "iterator" }
+func (iter *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+
+// Task functions
+func (task *Task) Inspect() string { return "task" }
+func (task *Task) Type() ObjectType { return TASK_OBJ }
+
+// Channel functions
+func (ch *Channel) Inspect() string { return "channel" }
+func (ch *Channel) Type() ObjectType { return CHANNEL_OBJ }
+
+// Send blocks until val is received or buffered. It reports false if the
+// channel is, or becomes, closed.
+func (ch *Channel) Send(val Object) bool {
+	ch.mu.Lock()
+	closed := ch.closed
+	ch.mu.Unlock()
+	if closed {
+		return false
+	}
+
+	select {
+	case ch.values <- val:
+		return true
+	case <-ch.done:
+		return false
+	}
+}
+
+// Receive blocks until a value is available. It reports false once the
+// channel is closed and drained.
+func (ch *Channel) Receive() (Object, bool) {
+	select {
+	case val := <-ch.values:
+		return val, true
+	case <-ch.done:
+	}
+
+	// Closed, but values buffered before then are still delivered.
+	select {
+	case val := <-ch.values:
+		return val, true
+	default:
+		return nil, false
+	}
+}
+
+// Close reports false if the channel was already closed.
+func (ch *Channel) Close() bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.closed {
+		return false
+	}
+	ch.closed = true
+	close(ch.done)
+	return true
+}
+
 // Return functions
 func (retVal *ReturnValue) Inspect() string { return retVal.Inspect() }
 func (retVal *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
@@ -129,3 +360,12 @@ func (fun *Function) Inspect() string {
 	return out.String()
 }
 func (fun *Function) Type() ObjectType { return FUNCTION_OBJ }
+
+// Label names the function and where it was defined, e.g. `add (3:11)`.
+func (fun *Function) Label() string {
+	name := fun.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return fmt.Sprintf("%s (%d:%d)", name, fun.Token.Line, fun.Token.Column)
+}
@@ -0,0 +1,113 @@
+package optimizer
+
+import "monkey/ast"
+
+// inlinable reports whether fn is small enough to inline and consists of a
+// single expression built from its parameters, literals and operators, so
+// that substituting literal arguments into it cannot change what it means.
+// Such a function cannot be recursive.
+func inlinable(fn *ast.FunctionLiteral) bool {
+	for _, pattern := range fn.ParameterPatterns {
+		if pattern != nil {
+			return false
+		}
+	}
+	body := bodyExpression(fn)
+	if body == nil {
+		return false
+	}
+
+	params := map[string]bool{}
+	for _, param := range fn.Parameters {
+		params[param.Value] = true
+	}
+
+	nodes := 0
+	ok := true
+	ast.Walk(body, func(node ast.Node) bool {
+		nodes++
+		switch node := node.(type) {
+		case *ast.Identifier:
+			ok = ok && params[node.Value]
+		case *ast.PrefixExpression, *ast.InfixExpression,
+			*ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		default:
+			ok = false
+		}
+		return ok
+	})
+	return ok && nodes <= maxInlineNodes
+}
+
+// bodyExpression returns the expression a function's body consists of:
+// its only statement, either an expression or a return.
+func bodyExpression(fn *ast.FunctionLiteral) ast.Expression {
+	if len(fn.Body.Statements) != 1 {
+		return nil
+	}
+	switch stmt := fn.Body.Statements[0].(type) {
+	case *ast.ExpressionStatement:
+		return stmt.Expression
+	case *ast.ReturnStatement:
+		return stmt.ReturnValue
+	}
+	return nil
+}
+
+// inline returns the body of the function call calls with its arguments
+// substituted for its parameters, or nil if the call cannot be inlined.
+// Only literal arguments are substituted: they cannot fail or have effects,
+// so it does not matter how often or in what order the body uses them.
+func (o *optimizer) inline(call *ast.CallExpression) ast.Expression {
+	var fn *ast.FunctionLiteral
+	switch callee := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		if inlinable(callee) {
+			fn = callee
+		}
+	case *ast.Identifier:
+		fn = o.scope.lookup(callee.Value)
+	}
+	if fn == nil || len(fn.Parameters) != len(call.Arguments) {
+		return nil
+	}
+
+	args := map[string]ast.Expression{}
+	for i, arg := range call.Arguments {
+		if _, ok := literalTruthy(arg); !ok {
+			return nil
+		}
+		args[fn.Parameters[i].Value] = arg
+	}
+	return substitute(bodyExpression(fn), args)
+}
+
+// substitute copies an inlinable body, replacing parameters by arguments.
+func substitute(expr ast.Expression, args map[string]ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return copyLiteral(args[expr.Value])
+	case *ast.PrefixExpression:
+		return &ast.PrefixExpression{Token: expr.Token, Operator: expr.Operator, Right: substitute(expr.Right, args)}
+	case *ast.InfixExpression:
+		return &ast.InfixExpression{
+			Token:    expr.Token,
+			Left:     substitute(expr.Left, args),
+			Operator: expr.Operator,
+			Right:    substitute(expr.Right, args),
+		}
+	}
+	return copyLiteral(expr)
+}
+
+func copyLiteral(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &ast.IntegerLiteral{Token: expr.Token, Value: expr.Value}
+	case *ast.StringLiteral:
+		return &ast.StringLiteral{Token: expr.Token, Value: expr.Value}
+	case *ast.Boolean:
+		return &ast.Boolean{Token: expr.Token, Value: expr.Value}
+	}
+	return expr
+}
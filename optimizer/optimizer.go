@@ -0,0 +1,398 @@
+// Package optimizer rewrites programs into cheaper equivalents before they
+// are evaluated. It folds constant integer, string and boolean operations,
+// drops if branches whose condition is a literal, and inlines calls with
+// literal arguments to small functions whose body is a single expression
+// of their parameters. Calls with other arguments, and larger functions,
+// are not inlined: their arguments would have to be bound with let, and a
+// block does not open a scope of its own, so the bindings would leak into
+// the caller's. The result evaluates to the same value, with the same
+// output and errors, as the original.
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/token"
+	"strconv"
+)
+
+// maxInlineNodes bounds the size of the body of a function worth inlining.
+const maxInlineNodes = 16
+
+// Optimize rewrites program in place and returns it.
+func Optimize(program *ast.Program) *ast.Program {
+	o := &optimizer{}
+	o.scope = newScope(nil, program.Statements)
+	program.Statements = o.statements(program.Statements, true)
+	return program
+}
+
+type optimizer struct {
+	scope *scope
+}
+
+// scope mirrors an environment the evaluator creates: the program's, a
+// function call's or a match arm's. Blocks of if expressions bind in the
+// scope they appear in.
+type scope struct {
+	outer *scope
+
+	// bindings counts the bindings of each name anywhere in the scope, as
+	// parameters or in let statements that may or may not run.
+	bindings map[string]int
+
+	// functions are the names bound only once, by a let statement of the
+	// scope's own body that has run before the code being rewritten, to a
+	// function that can be inlined.
+	functions map[string]*ast.FunctionLiteral
+}
+
+func newScope(outer *scope, body []ast.Statement, params ...ast.Node) *scope {
+	s := &scope{outer: outer, bindings: map[string]int{}, functions: map[string]*ast.FunctionLiteral{}}
+	for _, param := range params {
+		for _, name := range boundNames(param) {
+			s.bindings[name]++
+		}
+	}
+	for _, stmt := range body {
+		countBindings(stmt, s.bindings)
+	}
+	return s
+}
+
+// countBindings counts the names node binds in its own scope, leaving out
+// function literals and match arms, which have their own.
+func countBindings(node ast.Node, bindings map[string]int) {
+	ast.Walk(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			if n.Pattern != nil {
+				for _, name := range boundNames(n.Pattern) {
+					bindings[name]++
+				}
+			} else {
+				bindings[n.Name.Value]++
+			}
+			countBindings(n.Value, bindings)
+			return false
+		case *ast.StructStatement:
+			bindings[n.Name.Value]++
+			return false
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.MatchExpression:
+			countBindings(n.Subject, bindings)
+			return false
+		}
+		return true
+	})
+}
+
+// boundNames lists the identifiers a parameter or pattern binds.
+func boundNames(node ast.Node) []string {
+	names := []string{}
+	ast.Walk(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			names = append(names, n.Value)
+		case *ast.LiteralPattern:
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// lookup finds the function name refers to, if it is one that can be
+// inlined. The innermost scope binding name decides.
+func (s *scope) lookup(name string) *ast.FunctionLiteral {
+	for ; s != nil; s = s.outer {
+		if s.bindings[name] > 0 {
+			return s.functions[name]
+		}
+	}
+	return nil
+}
+
+// statements rewrites a list of statements. direct is set for the body of
+// a scope, as opposed to the block of an if expression within it.
+func (o *optimizer) statements(stmts []ast.Statement, direct bool) []ast.Statement {
+	result := []ast.Statement{}
+	for i, stmt := range stmts {
+		stmt = o.statement(stmt)
+		last := i == len(stmts)-1
+
+		if spliced, ok := spliceIf(stmt, last); ok {
+			result = append(result, spliced...)
+			continue
+		}
+		result = append(result, stmt)
+
+		if let, ok := stmt.(*ast.LetStatement); ok && direct && let.Name != nil {
+			if fn, ok := let.Value.(*ast.FunctionLiteral); ok && o.scope.bindings[let.Name.Value] == 1 && inlinable(fn) {
+				o.scope.functions[let.Name.Value] = fn
+			}
+		}
+	}
+	return result
+}
+
+// spliceIf replaces an if statement whose condition is a literal by the
+// statements of the branch it takes, which run in the same environment. An
+// if statement that takes no branch evaluates to null, so it can only go
+// if it is not the last statement, whose value is the block's value.
+func spliceIf(stmt ast.Statement, last bool) ([]ast.Statement, bool) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ifExp, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	truthy, ok := literalTruthy(ifExp.Condition)
+	if !ok {
+		return nil, false
+	}
+
+	branch := ifExp.Alternative
+	if truthy {
+		branch = ifExp.Consequence
+	}
+	switch {
+	case branch == nil && !last:
+		return []ast.Statement{}, true
+	case branch != nil && (len(branch.Statements) > 0 || !last):
+		return branch.Statements, true
+	}
+	return nil, false
+}
+
+func (o *optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+	}
+	return stmt
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = o.statements(block.Statements, false)
+	}
+}
+
+func (o *optimizer) expression(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		expr.Right = o.expression(expr.Right)
+		return foldPrefix(expr)
+	case *ast.InfixExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Right = o.expression(expr.Right)
+		return foldInfix(expr)
+	case *ast.IfExpression:
+		expr.Condition = o.expression(expr.Condition)
+		o.block(expr.Consequence)
+		o.block(expr.Alternative)
+		return pruneIf(expr)
+	case *ast.FunctionLiteral:
+		params := make([]ast.Node, len(expr.Parameters))
+		for i, param := range expr.Parameters {
+			params[i] = param
+			if i < len(expr.ParameterPatterns) && expr.ParameterPatterns[i] != nil {
+				params[i] = expr.ParameterPatterns[i]
+			}
+		}
+		o.scope = newScope(o.scope, expr.Body.Statements, params...)
+		expr.Body.Statements = o.statements(expr.Body.Statements, true)
+		o.scope = o.scope.outer
+	case *ast.CallExpression:
+		expr.Function = o.expression(expr.Function)
+		for i, arg := range expr.Arguments {
+			expr.Arguments[i] = o.expression(arg)
+		}
+		if inlined := o.inline(expr); inlined != nil {
+			return o.expression(inlined)
+		}
+	case *ast.ArrayLiteral:
+		for i, el := range expr.Elements {
+			expr.Elements[i] = o.expression(el)
+		}
+	case *ast.IndexExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Index = o.expression(expr.Index)
+	case *ast.StructLiteral:
+		expr.Struct = o.expression(expr.Struct)
+		for i, val := range expr.Values {
+			expr.Values[i] = o.expression(val)
+		}
+	case *ast.MemberExpression:
+		expr.Object = o.expression(expr.Object)
+	case *ast.SliceExpression:
+		expr.Left = o.expression(expr.Left)
+		expr.Start = o.optional(expr.Start)
+		expr.End = o.optional(expr.End)
+		expr.Step = o.optional(expr.Step)
+	case *ast.MatchExpression:
+		expr.Subject = o.expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			o.scope = newScope(o.scope, nil, arm.Pattern)
+			countBindings(arm.Guard, o.scope.bindings)
+			countBindings(arm.Body, o.scope.bindings)
+			arm.Guard = o.optional(arm.Guard)
+			arm.Body = o.expression(arm.Body)
+			o.scope = o.scope.outer
+		}
+	}
+	return expr
+}
+
+func (o *optimizer) optional(expr ast.Expression) ast.Expression {
+	if expr == nil {
+		return nil
+	}
+	return o.expression(expr)
+}
+
+// pruneIf replaces an if expression whose condition is a literal by the
+// expression its taken branch consists of, if that is all the branch is.
+func pruneIf(ifExp *ast.IfExpression) ast.Expression {
+	truthy, ok := literalTruthy(ifExp.Condition)
+	if !ok {
+		return ifExp
+	}
+	branch := ifExp.Alternative
+	if truthy {
+		branch = ifExp.Consequence
+	}
+	if branch == nil || len(branch.Statements) != 1 {
+		return ifExp
+	}
+	if es, ok := branch.Statements[0].(*ast.ExpressionStatement); ok {
+		return es.Expression
+	}
+	return ifExp
+}
+
+// literalTruthy reports whether expr is a literal and if so whether the
+// evaluator treats it as true: every literal but false is.
+func literalTruthy(expr ast.Expression) (truthy bool, ok bool) {
+	switch expr := expr.(type) {
+	case *ast.Boolean:
+		return expr.Value, true
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+// Constant folding
+
+func foldPrefix(expr *ast.PrefixExpression) ast.Expression {
+	switch expr.Operator {
+	case "!":
+		if truthy, ok := literalTruthy(expr.Right); ok {
+			return boolean(expr.Token, !truthy)
+		}
+	case "-":
+		if right, ok := expr.Right.(*ast.IntegerLiteral); ok {
+			return integer(expr.Token, -right.Value)
+		}
+	}
+	return expr
+}
+
+// foldInfix folds operations on literals, except those that fail at run
+// time, such as division by zero, which are left for the evaluator to
+// report.
+func foldInfix(expr *ast.InfixExpression) ast.Expression {
+	if _, ok := literalTruthy(expr.Left); !ok {
+		return expr
+	}
+	if _, ok := literalTruthy(expr.Right); !ok {
+		return expr
+	}
+
+	switch left := expr.Left.(type) {
+	case *ast.IntegerLiteral:
+		if right, ok := expr.Right.(*ast.IntegerLiteral); ok {
+			return foldIntegers(expr, left.Value, right.Value)
+		}
+	case *ast.StringLiteral:
+		if right, ok := expr.Right.(*ast.StringLiteral); ok {
+			if expr.Operator == "+" {
+				return str(expr.Token, left.Value+right.Value)
+			}
+			return expr
+		}
+	case *ast.Boolean:
+		if right, ok := expr.Right.(*ast.Boolean); ok {
+			switch expr.Operator {
+			case "==":
+				return boolean(expr.Token, left.Value == right.Value)
+			case "!=":
+				return boolean(expr.Token, left.Value != right.Value)
+			}
+			return expr
+		}
+	}
+
+	// Literals of different types are never the same object.
+	switch expr.Operator {
+	case "==":
+		return boolean(expr.Token, false)
+	case "!=":
+		return boolean(expr.Token, true)
+	}
+	return expr
+}
+
+func foldIntegers(expr *ast.InfixExpression, left, right int64) ast.Expression {
+	switch expr.Operator {
+	case "+":
+		return integer(expr.Token, left+right)
+	case "-":
+		return integer(expr.Token, left-right)
+	case "*":
+		return integer(expr.Token, left*right)
+	case "/":
+		if right != 0 {
+			return integer(expr.Token, left/right)
+		}
+	case "<":
+		return boolean(expr.Token, left < right)
+	case ">":
+		return boolean(expr.Token, left > right)
+	case "==":
+		return boolean(expr.Token, left == right)
+	case "!=":
+		return boolean(expr.Token, left != right)
+	}
+	return expr
+}
+
+// The folded literals keep the position of the operator they replace.
+
+func integer(at token.Token, value int64) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: positioned(at, token.INT, literal), Value: value}
+}
+
+func str(at token.Token, value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: positioned(at, token.STRING, value), Value: value}
+}
+
+func boolean(at token.Token, value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: positioned(at, token.TRUE, "true"), Value: true}
+	}
+	return &ast.Boolean{Token: positioned(at, token.FALSE, "false"), Value: false}
+}
+
+func positioned(at token.Token, typ token.TokenType, literal string) token.Token {
+	return token.Token{Type: typ, Literal: literal, Line: at.Line, Column: at.Column}
+}
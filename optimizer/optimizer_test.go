@@ -0,0 +1,123 @@
+package optimizer
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %v", input, p.Errors())
+	}
+	return program
+}
+
+// eval evaluates program and returns its result and output.
+func eval(program *ast.Program) (string, string) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetOutput(&out)
+
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		return "<nil>", out.String()
+	}
+	return result.Inspect(), out.String()
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let day = 60 * 60 * 24; day", "let day = 86400;day"},
+		{"-(2 * 3) + 10", "4"},
+		{"!true == false", "true"},
+		{"!0", "false"},
+		{"1 == true", "false"},
+		{`"a" != 1`, "true"},
+		{`"foo" + "bar"`, "foobar"},
+		{`"a" == "a"`, "(a == a)"},
+		{"true + false", "(true + false)"},
+		{"10 / 0", "(10 / 0)"},
+		{"x * (2 + 3)", "(x * 5)"},
+		{`if (1 > 2) { puts("big") } else { puts("small") }; 3`, "puts(small)3"},
+		{"if (false) { 1 }", "iffalse 1"},
+		{"if (false) { 1 }; 2", "2"},
+		{`let x = if (0) { "zero is truthy" } else { "no" }; x`, "let x = zero is truthy;x"},
+		{"let sq = fn(x) { x * x }; sq(3) + sq(4)", "let sq = fn(x) (x * x);25"},
+		{"fn(x, y) { return x - y }(10, 3)", "7"},
+		{"let sq = fn(x) { x * x }; sq(y)", "let sq = fn(x) (x * x);sq(y)"},
+		{"let sq = fn(x) { x * x }; let g = fn(sq) { sq(2) }; g", "let sq = fn(x) (x * x);let g = fn(sq) sq(2);g"},
+		{"let f = fn(x) { x }; let f = fn(x) { x * 10 }; f(2)", "let f = fn(x) x;let f = fn(x) (x * 10);f(2)"},
+		{"let g = fn() { sq(2) }; let sq = fn(x) { x * x }; g()", "let g = fn() sq(2);let sq = fn(x) (x * x);g()"},
+		{"let k = 2; let f = fn(x) { x * k }; f(3)", "let k = 2;let f = fn(x) (x * k);f(3)"},
+	}
+
+	for _, tt := range tests {
+		optimized := Optimize(parse(t, tt.input)).String()
+		if optimized != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, optimized)
+		}
+	}
+}
+
+// TestEquivalence checks that optimized programs evaluate like the
+// originals, including their output and errors.
+func TestEquivalence(t *testing.T) {
+	inputs := []string{
+		"let day = 60 * 60 * 24; day",
+		"-(2 * 3) + 10 * -1",
+		"[!true == false, !0, !!\"\", 1 == true, \"a\" != 1, true != false]",
+		`"foo" + "bar"`,
+		`"a" == "a"`,
+		"true + false",
+		"-true",
+		`if (1 > 2) { puts("big") } else { puts("small") }; 3`,
+		"if (false) { 1 }",
+		"if (false) { 1 }; 2",
+		"if (true) { }",
+		"if (true) { }; 1",
+		"let f = fn() { if (true) { return 1; } 2 }; f()",
+		"let f = fn(a) { if (true) { let b = a * 2; b } }; f(4)",
+		"if (true) { let sq = fn(x) { x * x }; }; sq(5)",
+		`let x = if (0) { "zero is truthy" } else { "no" }; x`,
+		"let sq = fn(x) { x * x }; sq(3) + sq(4)",
+		"let sq = fn(x) { return x * x; }; [sq(2), sq(-2)]",
+		"let sq = fn(x) { x * x }; let g = fn(sq) { sq(2) }; g(fn(x) { x + 1 })",
+		"let f = fn(x) { x }; let f = fn(x) { x * 10 }; f(2)",
+		"let g = fn() { sq(2) }; let sq = fn(x) { x * x }; g()",
+		"let f = fn() { sq(2) }; f()",
+		"let add = fn(a, b) { a + b }; add(1)",
+		`let add = fn(a, b) { a + b }; add("a", 1)`,
+		"let pick = fn(x, x) { x }; pick(1, 2)",
+		"let twice = fn(f, x) { f(f(x)) }; twice(fn(x) { x * 2 }, 5)",
+		"let k = 2; let f = fn(x) { x * k }; let k = 3; f(3)",
+		"let p = fn(x) { puts(x) }; p(1 + 2)",
+		"let [a, b] = [1 + 1, 2 * 2]; a * b",
+		"[1, 2, 3, 4][1 - 1:2 + 1:3 - 2]",
+		"match (2 + 3) { 5 => 10 * 10, _ => 0 }",
+		"let sq = fn(x) { x * x }; match (3) { sq => sq(2) }",
+		"let sq = fn(x) { x * x }; match (3) { n if n > sq(1) => sq(n), _ => 0 }",
+		"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)",
+		"let inc = fn(x) { x + 1 }; map([1, 2, 3], inc)",
+		"let id = fn(x) { x }; let y = 1; id(y)",
+	}
+
+	for _, input := range inputs {
+		wantResult, wantOutput := eval(parse(t, input))
+		gotResult, gotOutput := eval(Optimize(parse(t, input)))
+		if gotResult != wantResult || gotOutput != wantOutput {
+			t.Errorf("%q: optimized evaluation differs.\nwant: %q, output %q\ngot:  %q, output %q",
+				input, wantResult, wantOutput, gotResult, gotOutput)
+		}
+	}
+}
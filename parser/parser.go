@@ -30,7 +30,9 @@ var precedences = map[token.TokenType]int{
 	token.SLASH: PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN: CALL,
+	token.LBRACE: CALL,
 	token.LBRACKET: INDEX,
+	token.DOT: INDEX,
 }
 
 type Parser struct {
@@ -69,6 +71,7 @@ func New(lex *lexer.Lexer) *Parser {
 	parser.registerPrefix(token.FUNCTION, parser.parseFunctionLiteral)
 	parser.registerPrefix(token.STRING, parser.parseStringLiteral)
 	parser.registerPrefix(token.LBRACKET, parser.parseArrayLiteral)
+	parser.registerPrefix(token.MATCH, parser.parseMatchExpression)
 
 	parser.infixParseFns = make(map[token.TokenType]infixParseFn)
 	parser.registerInfix(token.PLUS, parser.parseInfixExpression)
@@ -81,12 +84,14 @@ func New(lex *lexer.Lexer) *Parser {
 	parser.registerInfix(token.GT, parser.parseInfixExpression)
 	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
 	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
+	parser.registerInfix(token.LBRACE, parser.parseStructLiteral)
+	parser.registerInfix(token.DOT, parser.parseMemberExpression)
 
 	return parser
 }
 
 func (parser *Parser) Errors() []string {
-	return parser.errors
+	return append(append([]string{}, parser.lex.Errors()...), parser.errors...)
 }
 
 func (parser *Parser) peekError(tokType token.TokenType) {
@@ -119,6 +124,8 @@ func (parser *Parser) parseStatement() ast.Statement {
 		return parser.parseLetStatement()
 	case token.RETURN:
 		return parser.parseReturnStatement()
+	case token.STRUCT:
+		return parser.parseStructStatement()
 	default:
 		return parser.parseExpressionStatement()
 	}
@@ -191,7 +198,13 @@ func (parser *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = parser.parseFunctionParameters()
+	lit.Parameters, lit.ParameterPatterns, lit.ParameterTypes = parser.parseFunctionParameters()
+
+	if parser.peekTokenIs(token.COLON) {
+		parser.nextToken()
+		parser.nextToken()
+		lit.ReturnType = parser.parseTypeExpression()
+	}
 
 	if !parser.expectPeek(token.LBRACE) {
 		return nil
@@ -209,11 +222,42 @@ func (parser *Parser) parseArrayLiteral() ast.Expression {
 }
 
 func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: parser.curToken, Left: left}
+	tok := parser.curToken
+
+	var index ast.Expression
+	if !parser.peekTokenIs(token.COLON) {
+		parser.nextToken()
+		index = parser.parseExpression(LOWEST)
+	}
+
+	if parser.peekTokenIs(token.COLON) {
+		return parser.parseSliceExpression(tok, left, index)
+	}
+
+	if !parser.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+func (parser *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
 
 	parser.nextToken()
-	exp.Index = parser.parseExpression(LOWEST)
-	
+	if !parser.peekTokenIs(token.COLON) && !parser.peekTokenIs(token.RBRACKET) {
+		parser.nextToken()
+		exp.End = parser.parseExpression(LOWEST)
+	}
+
+	if parser.peekTokenIs(token.COLON) {
+		parser.nextToken()
+		if !parser.peekTokenIs(token.RBRACKET) {
+			parser.nextToken()
+			exp.Step = parser.parseExpression(LOWEST)
+		}
+	}
+
 	if !parser.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -221,6 +265,56 @@ func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseStructLiteral parses the `{x: 1, y: 2}` following a struct type,
+// which builds a new struct, or a struct, which copies it with the given
+// fields changed.
+func (parser *Parser) parseStructLiteral(left ast.Expression) ast.Expression {
+	literal := &ast.StructLiteral{Token: parser.curToken, Struct: left, Fields: []*ast.Identifier{}, Values: []ast.Expression{}}
+	seen := map[string]bool{}
+
+	for !parser.peekTokenIs(token.RBRACE) {
+		if !parser.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+		if seen[field.Value] {
+			msg := fmt.Sprintf("duplicate field %s in struct literal", field.Value)
+			parser.errors = append(parser.errors, msg)
+			return nil
+		}
+		seen[field.Value] = true
+
+		if !parser.expectPeek(token.COLON) {
+			return nil
+		}
+		parser.nextToken()
+		value := parser.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		literal.Fields = append(literal.Fields, field)
+		literal.Values = append(literal.Values, value)
+
+		if !parser.peekTokenIs(token.RBRACE) && !parser.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	parser.nextToken()
+
+	return literal
+}
+
+func (parser *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: parser.curToken, Object: object}
+
+	if !parser.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+
+	return exp
+}
+
 func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: parser.curToken, Function: function}
 	exp.Arguments = parser.parseExpressionList(token.RPAREN)
@@ -252,31 +346,114 @@ func (parser *Parser) parseCallArguments() []ast.Expression {
 	return args
 }
 
-func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
+func (parser *Parser) parseFunctionParameters() ([]*ast.Identifier, []*ast.ArrayPattern, []ast.TypeExpression) {
 	identifiers := []*ast.Identifier{}
+	patterns := []*ast.ArrayPattern{}
+	types := []ast.TypeExpression{}
 
 	if parser.peekTokenIs(token.RPAREN) {
 		parser.nextToken()
-		return identifiers
+		return identifiers, patterns, types
 	}
 
 	parser.nextToken()
 
-	ident := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	ident, pattern := parser.parseParameter()
 	identifiers = append(identifiers, ident)
+	patterns = append(patterns, pattern)
+	types = append(types, parser.parseOptionalTypeAnnotation())
 
 	for parser.peekTokenIs(token.COMMA) {
 		parser.nextToken()
 		parser.nextToken()
-		ident := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+		ident, pattern := parser.parseParameter()
 		identifiers = append(identifiers, ident)
+		patterns = append(patterns, pattern)
+		types = append(types, parser.parseOptionalTypeAnnotation())
 	}
 
 	if !parser.expectPeek(token.RPAREN) {
+		return nil, nil, nil
+	}
+
+	return identifiers, patterns, types
+}
+
+// parseParameter parses a plain or destructured parameter. A destructured
+// parameter is named after its pattern.
+func (parser *Parser) parseParameter() (*ast.Identifier, *ast.ArrayPattern) {
+	if !parser.curTokenIs(token.LBRACKET) {
+		return &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}, nil
+	}
+
+	tok := parser.curToken
+	pattern, ok := parser.parseArrayPattern().(*ast.ArrayPattern)
+	if !ok {
+		return &ast.Identifier{Token: tok, Value: tok.Literal}, nil
+	}
+
+	return &ast.Identifier{Token: tok, Value: pattern.String()}, pattern
+}
+
+// parseOptionalTypeAnnotation parses a `: type` suffix if one follows the
+// current token and returns nil otherwise.
+func (parser *Parser) parseOptionalTypeAnnotation() ast.TypeExpression {
+	if !parser.peekTokenIs(token.COLON) {
 		return nil
 	}
 
-	return identifiers
+	parser.nextToken()
+	parser.nextToken()
+
+	return parser.parseTypeExpression()
+}
+
+func (parser *Parser) parseTypeExpression() ast.TypeExpression {
+	switch parser.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: parser.curToken, Name: parser.curToken.Literal}
+	case token.LBRACKET:
+		arrayType := &ast.ArrayType{Token: parser.curToken}
+		parser.nextToken()
+		arrayType.Element = parser.parseTypeExpression()
+		if arrayType.Element == nil || !parser.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return arrayType
+	case token.FUNCTION:
+		fnType := &ast.FunctionType{Token: parser.curToken}
+		if !parser.expectPeek(token.LPAREN) {
+			return nil
+		}
+		fnType.Parameters = []ast.TypeExpression{}
+		if parser.peekTokenIs(token.RPAREN) {
+			parser.nextToken()
+		} else {
+			parser.nextToken()
+			fnType.Parameters = append(fnType.Parameters, parser.parseTypeExpression())
+			for parser.peekTokenIs(token.COMMA) {
+				parser.nextToken()
+				parser.nextToken()
+				fnType.Parameters = append(fnType.Parameters, parser.parseTypeExpression())
+			}
+			if !parser.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !parser.expectPeek(token.COLON) {
+			return nil
+		}
+		parser.nextToken()
+		fnType.Return = parser.parseTypeExpression()
+		if fnType.Return == nil {
+			return nil
+		}
+		return fnType
+	default:
+		msg := fmt.Sprintf("expected type, got %s instead", parser.curToken.Type)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
 }
 
 func (parser *Parser) parseIfExpression() ast.Expression {
@@ -313,6 +490,134 @@ func (parser *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (parser *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: parser.curToken}
+
+	if !parser.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	parser.nextToken()
+	expression.Subject = parser.parseExpression(LOWEST)
+
+	if !parser.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !parser.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Arms = []*ast.MatchArm{}
+	for !parser.peekTokenIs(token.RBRACE) {
+		parser.nextToken()
+
+		arm := parser.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !parser.peekTokenIs(token.RBRACE) && !parser.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	parser.nextToken()
+
+	return expression
+}
+
+func (parser *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: parser.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if parser.peekTokenIs(token.IF) {
+		parser.nextToken()
+		parser.nextToken()
+		arm.Guard = parser.parseExpression(LOWEST)
+	}
+
+	if !parser.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	parser.nextToken()
+	if parser.curTokenIs(token.LBRACE) {
+		arm.Body = parser.parseBlockStatement()
+	} else {
+		arm.Body = parser.parseExpression(LOWEST)
+	}
+
+	return arm
+}
+
+func (parser *Parser) parsePattern() ast.Pattern {
+	switch parser.curToken.Type {
+	case token.IDENT:
+		if parser.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: parser.curToken}
+		}
+		return &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	case token.INT, token.STRING, token.TRUE, token.FALSE:
+		value := parser.prefixParseFns[parser.curToken.Type]()
+		if value == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Token: parser.curToken, Value: value}
+	case token.MINUS:
+		minus := parser.curToken
+		if !parser.expectPeek(token.INT) {
+			return nil
+		}
+		right := parser.parseIntegerLiteral()
+		if right == nil {
+			return nil
+		}
+		value := &ast.PrefixExpression{Token: minus, Operator: "-", Right: right}
+		return &ast.LiteralPattern{Token: minus, Value: value}
+	case token.LBRACKET:
+		return parser.parseArrayPattern()
+	default:
+		msg := fmt.Sprintf("expected pattern, got %s instead", parser.curToken.Type)
+		parser.errors = append(parser.errors, msg)
+		return nil
+	}
+}
+
+func (parser *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: parser.curToken, Elements: []ast.Pattern{}}
+
+	for !parser.peekTokenIs(token.RBRACKET) {
+		parser.nextToken()
+
+		if parser.curTokenIs(token.ELLIPSIS) {
+			if !parser.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+			break
+		}
+
+		element := parser.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !parser.peekTokenIs(token.RBRACKET) && !parser.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !parser.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
 func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: parser.curToken}
 	block.Statements = []ast.Statement{}
@@ -338,19 +643,67 @@ func (parser *Parser) parseIdentifier() ast.Expression {
 func (parser *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: parser.curToken}
 
-	if !parser.expectPeek(token.IDENT) {
+	if parser.peekTokenIs(token.LBRACKET) {
+		parser.nextToken()
+		pattern, ok := parser.parseArrayPattern().(*ast.ArrayPattern)
+		if !ok {
+			return nil
+		}
+		stmt.Pattern = pattern
+	} else {
+		if !parser.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	}
+	stmt.Type = parser.parseOptionalTypeAnnotation()
+
+	if !parser.expectPeek(token.ASSIGN) {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+	parser.nextToken()
+	stmt.Value = parser.parseExpression(LOWEST)
 
+	if parser.peekTokenIs(token.SEMICOLON) {
+		parser.nextToken()
+	}
 
-	if !parser.expectPeek(token.ASSIGN) {
+	return stmt
+}
+
+func (parser *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: parser.curToken, Fields: []*ast.Identifier{}}
+
+	if !parser.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+
+	if !parser.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	seen := map[string]bool{}
+	for !parser.peekTokenIs(token.RBRACE) {
+		if !parser.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: parser.curToken, Value: parser.curToken.Literal}
+		if seen[field.Value] {
+			msg := fmt.Sprintf("duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+			parser.errors = append(parser.errors, msg)
+			return nil
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !parser.peekTokenIs(token.RBRACE) && !parser.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
 	parser.nextToken()
-	stmt.Value = parser.parseExpression(LOWEST)
 
 	if parser.peekTokenIs(token.SEMICOLON) {
 		parser.nextToken()
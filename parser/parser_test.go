@@ -742,6 +742,225 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 1;", "let x: int = 1;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{"let f: fn(int, bool): [int] = g;", "let f: fn(int, bool): [int] = g;"},
+		{"fn(a: string, b): int { a }", "fn(a: string, b): int a"},
+		{"fn(f: fn(): int) { f() }", "fn(f: fn(): int) f()"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestLexerErrorsAreReported(t *testing.T) {
+	l := lexer.New("let x = \"\xff\";")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "1:10: invalid UTF-8 encoding" {
+		t.Errorf("lexer error not reported. got=%q", errors)
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:2]", "(a[1:2])"},
+		{"a[:2]", "(a[:2])"},
+		{"a[1:]", "(a[1:])"},
+		{"a[:]", "(a[:])"},
+		{"a[::2]", "(a[::2])"},
+		{"a[1:-1:2]", "(a[1:(-1):2])"},
+		{"a[b + 1:c * 2]", "(a[(b + 1):(c * 2)])"},
+		{"a[1:][0]", "((a[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestParsingMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one", _ => "other" }`, `match (x) { 1 => one, _ => other }`},
+		{`match (x) { -1 => a, true => b, "s" => c, }`, `match (x) { (-1) => a, true => b, s => c }`},
+		{`match (xs) { [] => 0, [h, ...t] => h + 1 }`, `match (xs) { [] => 0, [h, ...t] => (h + 1) }`},
+		{`match (xs) { [[a, _], ..._] => a }`, `match (xs) { [[a, _], ..._] => a }`},
+		{`match (x) { n if n > 10 => n * 2, n => { let y = n; y } }`, `match (x) { n if (n > 10) => (n * 2), n => let y = n;y }`},
+		{`let r = match (f(x)) { _ => 1 } + 2;`, `let r = (match (f(x)) { _ => 1 } + 2);`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestMatchParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 + 2 => 3 }`, "expected next token to be =>, got + instead"},
+		{`match (x) { (a) => 3 }`, "expected pattern, got ( instead"},
+		{`match (x) { [...t, a] => 3 }`, "expected next token to be ], got , instead"},
+		{`match (x) { 1 => 2 3 => 4 }`, "expected next token to be ,, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: expected error %q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestParsingDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = [1, 2];", "let [a, b] = [1, 2];"},
+		{"let [h, ...t]: [int] = xs;", "let [h, ...t]: [int] = xs;"},
+		{"let [a, [b, _]] = xs;", "let [a, [b, _]] = xs;"},
+		{"fn([a, b], c) { a }", "fn([a, b], c) a"},
+		{"fn([a, ...b]: [int]): int { a }", "fn([a, ...b]: [int]): int a"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestParsingStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "struct Point { x, y }"},
+		{"struct Empty {};", "struct Empty {}"},
+		{"struct Pair { first, second, }", "struct Pair { first, second }"},
+		{"Point{x: 1, y: 2 * 3}", "Point{x: 1, y: (2 * 3)}"},
+		{"Point{}", "Point{}"},
+		{"p{x: 3,}", "p{x: 3}"},
+		{"p.x", "(p.x)"},
+		{"a.b.c", "((a.b).c)"},
+		{"p.x + p.y * 2", "((p.x) + ((p.y) * 2))"},
+		{"-p.x", "(-(p.x))"},
+		{"line.points[0].x", "(((line.points)[0]).x)"},
+		{"f(a).b", "(f(a).b)"},
+		{"Point{x: 1, y: 2}.x", "(Point{x: 1, y: 2}.x)"},
+		{"p{x: p.x + 1}", "p{x: ((p.x) + 1)}"},
+		{"if (p.x) { Point{x: 1} }", "if(p.x) Point{x: 1}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestStructParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct { x }", "expected next token to be IDENT, got { instead"},
+		{"struct Point { x, x }", "duplicate field x in struct Point"},
+		{"struct Point { x y }", "expected next token to be ,, got IDENT instead"},
+		{"Point{x: 1, x: 2}", "duplicate field x in struct literal"},
+		{"Point{x 1}", "expected next token to be :, got INT instead"},
+		{"p.1", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: expected error %q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestASTJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"let x: int = 5 * (2 + -y); return x;",
+		`let greet = fn(name: string, [a, ...rest]): [int] { if (!name) { "anon" } else { name } };`,
+		"add(1, [2, 3][0], xs[1:-1:2], xs[::2], fn(f: fn(int): bool) { f(1) });",
+		`match (xs) { [] => 0, [1, _, ...t] if t => { t }, "s" => -1, n => n }`,
+		"let [a, [b, _]] = pair; a == b != true",
+		"struct Point { x, y } let p = Point{x: 1, y: 2}; p{x: p.y}.x",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		encoded := ast.ToJSON(program)
+		decoded, err := ast.FromJSON(encoded)
+		if err != nil {
+			t.Errorf("%q: FromJSON failed: %s", input, err)
+			continue
+		}
+		if decoded.String() != program.String() {
+			t.Errorf("%q: round trip changed program. expected=%q, got=%q", input, program.String(), decoded.String())
+		}
+		if reencoded := ast.ToJSON(decoded); string(reencoded) != string(encoded) {
+			t.Errorf("%q: round trip changed JSON.\nexpected=%s\ngot=%s", input, encoded, reencoded)
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
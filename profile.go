@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/profiler"
+	"os"
+)
+
+// profileFile runs a script like runFile, then prints where it spent its
+// time to stderr and, with --pprof, writes a profile for `go tool pprof`.
+func profileFile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	pprofPath := flags.String("pprof", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+	path := flags.Arg(0)
+
+	program, ok := parseFile(path)
+	if !ok {
+		return 1
+	}
+
+	env := object.NewEnvironment()
+	env.SetOutput(os.Stdout)
+	env.SetInput(os.Stdin)
+
+	prof := profiler.New(path)
+	status := 0
+	if errObj, ok := prof.Run(program, env).(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, errObj.Message)
+		status = 1
+	}
+	prof.WriteReport(os.Stderr)
+
+	if *pprofPath != "" {
+		if err := writeFile(*pprofPath, prof.WritePprof); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return status
+}
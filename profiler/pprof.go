@@ -0,0 +1,150 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// WritePprof writes the profile in the gzipped protocol buffer format read
+// by `go tool pprof`. Each sample is one call stack, valued by the calls
+// that ended in it and the self time they took, so flame graphs stack
+// Monkey functions the way they called each other.
+func (p *Profiler) WritePprof(out io.Writer) error {
+	strs := &stringTable{index: map[string]int64{}}
+	strs.add("")
+
+	prof := &protoBuffer{}
+	for _, valueType := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		vt := &protoBuffer{}
+		vt.int64(1, strs.add(valueType[0]))
+		vt.int64(2, strs.add(valueType[1]))
+		prof.message(1, vt)
+	}
+
+	samples := make([]*sample, 0, len(p.samples))
+	for _, s := range p.samples {
+		samples = append(samples, s)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].self > samples[j].self })
+	for _, s := range samples {
+		locations := make([]uint64, len(s.stack))
+		for i, entry := range s.stack {
+			locations[i] = uint64(entry.id)
+		}
+		sb := &protoBuffer{}
+		sb.packed(1, locations)
+		sb.packed(2, []uint64{uint64(s.calls), uint64(s.self)})
+		prof.message(2, sb)
+	}
+
+	entries := p.Entries()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	for _, entry := range entries {
+		line := &protoBuffer{}
+		line.int64(1, int64(entry.id))
+		line.int64(2, int64(entry.Line))
+
+		loc := &protoBuffer{}
+		loc.int64(1, int64(entry.id))
+		loc.message(4, line)
+		prof.message(4, loc)
+	}
+	for _, entry := range entries {
+		filename := int64(0)
+		if !entry.Builtin {
+			filename = strs.add(p.filename)
+		}
+		fn := &protoBuffer{}
+		fn.int64(1, int64(entry.id))
+		fn.int64(2, strs.add(entry.Name))
+		fn.int64(3, strs.add(entry.Name))
+		fn.int64(4, filename)
+		fn.int64(5, int64(entry.Line))
+		prof.message(5, fn)
+	}
+
+	prof.int64(9, p.started.UnixNano())
+	prof.int64(10, int64(p.elapsed))
+	period := &protoBuffer{}
+	period.int64(1, strs.add("time"))
+	period.int64(2, strs.add("nanoseconds"))
+	prof.message(11, period)
+	prof.int64(12, 1)
+	prof.int64(14, strs.add("time"))
+
+	// The string table is written last as it is only complete now; field
+	// order does not matter to decoders.
+	for _, s := range strs.strings {
+		prof.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := gz.Write(prof.buf); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type stringTable struct {
+	strings []string
+	index   map[string]int64
+}
+
+func (t *stringTable) add(s string) int64 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+	t.index[s] = int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	return t.index[s]
+}
+
+// protoBuffer encodes the few protocol buffer field types profile.proto
+// uses. Zero scalars are omitted, as proto3 encoders do.
+type protoBuffer struct {
+	buf []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.buf)
+}
+
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	data := &protoBuffer{}
+	for _, x := range xs {
+		data.varint(x)
+	}
+	b.bytes(field, data.buf)
+}
@@ -0,0 +1,199 @@
+// Package profiler measures where a Monkey program spends its time. It
+// times every call of a function or builtin, aggregating functions by the
+// position of their definition, and reports call counts with self and
+// total time as a table or as a pprof profile.
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Entry is the profile of one function, builtin or the top-level program.
+// Self excludes time spent in the calls it makes; Total includes it, but
+// counts time in recursive calls only once.
+type Entry struct {
+	Name    string // the function's label, "builtin NAME" or "main"
+	Line    int    // where the function is defined; 0 for builtins
+	Column  int
+	Builtin bool
+	Calls   int
+	Self    time.Duration
+	Total   time.Duration
+
+	id     int
+	active int // calls currently on the stack
+}
+
+// sample is the time spent in one call stack, excluding the calls it makes.
+type sample struct {
+	stack []*Entry // innermost first
+	calls int
+	self  time.Duration
+}
+
+type frame struct {
+	entry    *Entry
+	start    time.Duration
+	children time.Duration
+}
+
+// Profiler is an object.Tracer that profiles one evaluation. A call in tail
+// position replaces its caller, so it is attributed to the caller's caller.
+// Spawned tasks are not traced; the time they take shows up in whoever
+// awaits them.
+type Profiler struct {
+	filename string
+	now      func() time.Duration
+	started  time.Time
+	elapsed  time.Duration
+
+	entries map[string]*Entry
+	samples map[string]*sample
+	stack   []*frame
+}
+
+// New returns a Profiler for a program read from filename, which pprof
+// profiles give as the source file of its functions.
+func New(filename string) *Profiler {
+	p := &Profiler{
+		filename: filename,
+		entries:  map[string]*Entry{},
+		samples:  map[string]*sample{},
+	}
+	p.now = func() time.Duration { return time.Since(p.started) }
+	return p
+}
+
+// Run evaluates program in env while profiling it and returns its result.
+func (p *Profiler) Run(program *ast.Program, env *object.Environment) object.Object {
+	p.started = time.Now()
+	p.enter(p.entry("main", func() *Entry { return &Entry{Name: "main"} }))
+
+	defer env.SetTracer(env.Context().Tracer)
+	env.SetTracer(p)
+	result := evaluator.Eval(program, env)
+
+	p.exit()
+	p.elapsed = p.now()
+	return result
+}
+
+func (p *Profiler) Statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	return nil
+}
+
+func (p *Profiler) Call(fn object.Object, env *object.Environment) {
+	switch fn := fn.(type) {
+	case *object.Function:
+		key := fmt.Sprintf("%d:%d", fn.Token.Line, fn.Token.Column)
+		p.enter(p.entry(key, func() *Entry {
+			return &Entry{Name: fn.Label(), Line: fn.Token.Line, Column: fn.Token.Column}
+		}))
+	case *object.Builtin:
+		p.enter(p.entry("builtin "+fn.Name, func() *Entry {
+			return &Entry{Name: "builtin " + fn.Name, Builtin: true}
+		}))
+	}
+}
+
+func (p *Profiler) Return(fn object.Object, result object.Object) {
+	p.exit()
+}
+
+// entry returns the entry for key, creating it with create the first time.
+func (p *Profiler) entry(key string, create func() *Entry) *Entry {
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = create()
+		entry.id = len(p.entries) + 1
+		p.entries[key] = entry
+	}
+	return entry
+}
+
+func (p *Profiler) enter(entry *Entry) {
+	entry.active++
+	p.stack = append(p.stack, &frame{entry: entry, start: p.now()})
+}
+
+func (p *Profiler) exit() {
+	if len(p.stack) == 0 {
+		return
+	}
+	f := p.stack[len(p.stack)-1]
+	elapsed := p.now() - f.start
+	self := elapsed - f.children
+
+	f.entry.active--
+	f.entry.Calls++
+	f.entry.Self += self
+	if f.entry.active == 0 {
+		f.entry.Total += elapsed
+	}
+
+	var key strings.Builder
+	stack := make([]*Entry, 0, len(p.stack))
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		stack = append(stack, p.stack[i].entry)
+		fmt.Fprintf(&key, "%d;", p.stack[i].entry.id)
+	}
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &sample{stack: stack}
+		p.samples[key.String()] = s
+	}
+	s.calls++
+	s.self += self
+
+	p.stack = p.stack[:len(p.stack)-1]
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+// Entries returns the profiled functions, the most self time first.
+func (p *Profiler) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Self != entries[j].Self {
+			return entries[i].Self > entries[j].Self
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// WriteReport prints the entries as an aligned table, with self and total
+// time also given as a share of the whole run.
+func (p *Profiler) WriteReport(out io.Writer) {
+	percent := func(d time.Duration) float64 {
+		if p.elapsed == 0 {
+			return 0
+		}
+		return 100 * float64(d) / float64(p.elapsed)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "CALLS\tSELF\tSELF%\tTOTAL\tTOTAL%\t\tFUNCTION")
+	for _, entry := range p.Entries() {
+		fmt.Fprintf(w, "%d\t%s\t%.1f%%\t%s\t%.1f%%\t\t%s\n",
+			entry.Calls,
+			entry.Self.Round(time.Microsecond),
+			percent(entry.Self),
+			entry.Total.Round(time.Microsecond),
+			percent(entry.Total),
+			entry.Name)
+	}
+	w.Flush()
+}
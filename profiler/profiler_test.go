@@ -0,0 +1,246 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+const program = `let fib = fn(n) {
+  if (n < 2) { n } else { fib(n - 1) + fib(n - 2) }
+};
+let double = fn(xs) { map(xs, fn(x) { x * 2 }) };
+let result = double([fib(5), fib(3)]);
+len(result)
+`
+
+// profile runs program with a clock that advances a millisecond each time
+// it is read.
+func profile(t *testing.T) *Profiler {
+	t.Helper()
+	p := parser.New(lexer.New(program))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	prof := New("fib.mk")
+	var clock time.Duration
+	prof.now = func() time.Duration {
+		clock += time.Millisecond
+		return clock
+	}
+	env := object.NewEnvironment()
+	if result := prof.Run(prog, env); result.Inspect() != "2" {
+		t.Fatalf("wrong result: %s", result.Inspect())
+	}
+	if env.Context().Tracer != nil {
+		t.Errorf("tracer left installed after Run")
+	}
+	return prof
+}
+
+func TestEntries(t *testing.T) {
+	prof := profile(t)
+
+	calls := map[string]int{}
+	entries := map[string]*Entry{}
+	var self time.Duration
+	for _, entry := range prof.Entries() {
+		calls[entry.Name] = entry.Calls
+		entries[entry.Name] = entry
+		self += entry.Self
+		if entry.Self > entry.Total {
+			t.Errorf("%s: self %s exceeds total %s", entry.Name, entry.Self, entry.Total)
+		}
+	}
+
+	expected := map[string]int{
+		"main":               1,
+		"fib (1:11)":         15 + 5,
+		"double (4:14)":      1,
+		"builtin map":        1,
+		"<anonymous> (4:31)": 2,
+		"builtin len":        1,
+	}
+	if len(calls) != len(expected) {
+		t.Errorf("wrong entries. want=%v, got=%v", expected, calls)
+	}
+	for name, want := range expected {
+		if calls[name] != want {
+			t.Errorf("%s: wrong number of calls. want=%d, got=%d", name, want, calls[name])
+		}
+	}
+
+	main := entries["main"]
+	if self != main.Total || prof.elapsed < main.Total {
+		t.Errorf("self times add up to %s, want main's total %s", self, main.Total)
+	}
+	if fib := entries["fib (1:11)"]; fib.Total >= main.Total || fib.Self != fib.Total {
+		t.Errorf("recursive calls counted twice: fib self=%s total=%s", fib.Self, fib.Total)
+	}
+	if entries["fib (1:11)"].Line != 1 || !entries["builtin map"].Builtin {
+		t.Errorf("wrong entry positions")
+	}
+}
+
+func TestRunLeavesOuterContextAlone(t *testing.T) {
+	prog := parser.New(lexer.New("1 + 1")).ParseProgram()
+	outer := object.NewEnvironment()
+	other := New("other.mk")
+	outer.SetTracer(other)
+	env := object.NewEnclosedEnvironment(outer)
+
+	New("main.mk").Run(prog, env)
+	if outer.Context().Tracer != other {
+		t.Errorf("Run replaced the tracer of the enclosed environment's outer context")
+	}
+	if env.Context().Tracer != other {
+		t.Errorf("Run did not restore the environment's tracer")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	var out bytes.Buffer
+	profile(t).WriteReport(&out)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("wrong number of lines. got=%q", out.String())
+	}
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "CALLS SELF SELF% TOTAL TOTAL% FUNCTION" {
+		t.Errorf("wrong header: %q", lines[0])
+	}
+	if fields := strings.Fields(lines[1]); fields[0] != "20" || fields[len(fields)-2] != "fib" {
+		t.Errorf("most expensive entry should be fib, got %q", lines[1])
+	}
+}
+
+// field is a decoded protocol buffer field: an integer for varints or the
+// raw bytes of a length-delimited field.
+type field struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+type decoder struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (d *decoder) varint() uint64 {
+	var x uint64
+	for shift := 0; ; shift += 7 {
+		if len(d.buf) == 0 {
+			d.t.Fatalf("truncated varint")
+		}
+		b := d.buf[0]
+		d.buf = d.buf[1:]
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return x
+		}
+	}
+}
+
+func decodeFields(t *testing.T, buf []byte) []field {
+	t.Helper()
+	d := &decoder{t: t, buf: buf}
+	fields := []field{}
+	for len(d.buf) > 0 {
+		key := d.varint()
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value = d.varint()
+		case wireBytes:
+			n := d.varint()
+			f.data, d.buf = d.buf[:n], d.buf[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func decodePacked(t *testing.T, buf []byte) []uint64 {
+	t.Helper()
+	d := &decoder{t: t, buf: buf}
+	values := []uint64{}
+	for len(d.buf) > 0 {
+		values = append(values, d.varint())
+	}
+	return values
+}
+
+func TestWritePprof(t *testing.T) {
+	prof := profile(t)
+	var out bytes.Buffer
+	if err := prof.WritePprof(&out); err != nil {
+		t.Fatalf("WritePprof failed: %s", err)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %s", err)
+	}
+	data, _ := io.ReadAll(gz)
+
+	var strs []string
+	var samples, functions, locations int
+	var calls, nanoseconds uint64
+	for _, f := range decodeFields(t, data) {
+		switch f.num {
+		case 2:
+			samples++
+			for _, sf := range decodeFields(t, f.data) {
+				if sf.num == 2 {
+					values := decodePacked(t, sf.data)
+					calls += values[0]
+					nanoseconds += values[1]
+				}
+			}
+		case 4:
+			locations++
+		case 5:
+			functions++
+		case 6:
+			strs = append(strs, string(f.data))
+		}
+	}
+
+	if samples != len(prof.samples) {
+		t.Errorf("wrong number of samples. want=%d, got=%d", len(prof.samples), samples)
+	}
+	if functions != len(prof.entries) || locations != len(prof.entries) {
+		t.Errorf("want a function and location per entry, got %d and %d", functions, locations)
+	}
+	var wantCalls int
+	for _, entry := range prof.entries {
+		wantCalls += entry.Calls
+	}
+	if calls != uint64(wantCalls) || nanoseconds != uint64(prof.entries["main"].Total) {
+		t.Errorf("sample values add up to %d calls and %dns, want %d and %d",
+			calls, nanoseconds, wantCalls, prof.entries["main"].Total)
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with the empty string: %q", strs)
+	}
+	for _, want := range []string{"fib (1:11)", "builtin map", "fib.mk", "time", "nanoseconds"} {
+		found := false
+		for _, s := range strs {
+			found = found || s == want
+		}
+		if !found {
+			t.Errorf("string table lacks %q", want)
+		}
+	}
+}
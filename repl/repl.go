@@ -8,13 +8,25 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"monkey/typecheck"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+type session struct {
+	out io.Writer
+	env *object.Environment
+	checker *typecheck.Checker
+	showTokens bool
+}
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	env.SetOutput(out)
+	sess := &session{out: out, env: env}
 	for {
 		fmt.Fprintf(out, PROMPT)
 		scanned := scanner.Scan()
@@ -23,6 +35,15 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			sess.runCommand(strings.Fields(line[1:]))
+			continue
+		}
+
+		if sess.showTokens {
+			token.WriteTable(out, lexer.Tokenize(line))
+		}
+
 		lex := lexer.New(line)
 		parser := parser.New(lex)
 		program := parser.ParseProgram()
@@ -32,6 +53,13 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		if sess.checker != nil {
+			if typeErrors := sess.checker.Check(program); len(typeErrors) != 0 {
+				printTypeErrors(out, typeErrors)
+				continue
+			}
+		}
+
 		evaluated := evaluator.Eval(program, env)
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
@@ -40,8 +68,53 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+func (sess *session) runCommand(fields []string) {
+	if len(fields) == 0 {
+		fields = []string{"help"}
+	}
+
+	switch fields[0] {
+	case "typecheck":
+		if sess.checker == nil {
+			sess.checker = typecheck.New()
+			io.WriteString(sess.out, "type checking on\n")
+		} else {
+			sess.checker = nil
+			io.WriteString(sess.out, "type checking off\n")
+		}
+	case "tokens":
+		sess.showTokens = !sess.showTokens
+		if sess.showTokens {
+			io.WriteString(sess.out, "token display on\n")
+		} else {
+			io.WriteString(sess.out, "token display off\n")
+		}
+	case "help":
+		if len(fields) == 1 {
+			io.WriteString(sess.out, "commands: :help [builtin], :tokens, :typecheck\n")
+			io.WriteString(sess.out, "builtins: "+strings.Join(evaluator.BuiltinNames(), ", ")+"\n")
+			return
+		}
+		for _, name := range fields[1:] {
+			if help, ok := evaluator.BuiltinHelp(name); ok {
+				io.WriteString(sess.out, help+"\n")
+			} else {
+				fmt.Fprintf(sess.out, "no builtin named %s\n", name)
+			}
+		}
+	default:
+		fmt.Fprintf(sess.out, "unknown command :%s\n", fields[0])
+	}
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printTypeErrors(out io.Writer, errors []*typecheck.Error) {
+	for _, err := range errors {
+		io.WriteString(out, "\t"+err.Error()+"\n")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiled"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+)
+
+// runFile evaluates a script with stdin and stdout attached, so scripts can
+// be used as filters in shell pipelines. It returns the process exit code.
+func runFile(path string) int {
+	program, ok := parseFile(path)
+	if !ok {
+		return 1
+	}
+
+	env := object.NewEnvironment()
+	env.SetOutput(os.Stdout)
+	env.SetInput(os.Stdin)
+
+	result := evaluator.Eval(program, env)
+	if errObj, ok := result.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, errObj.Message)
+		return 1
+	}
+
+	return 0
+}
+
+// parseFile reads and parses a script, or loads one compiled by `monkey
+// build`, reporting any errors on stderr.
+func parseFile(path string) (*ast.Program, bool) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+
+	if compiled.IsCompiled(source) {
+		program, err := compiled.Decode(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return nil, false
+		}
+		return program, true
+	}
+	return parseSource(path, source)
+}
+
+// readScript is parseFile for callers that also need the source, so it
+// only accepts source files.
+func readScript(path string) (string, *ast.Program, bool) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", nil, false
+	}
+
+	program, ok := parseSource(path, source)
+	return string(source), program, ok
+}
+
+func parseSource(path string, source []byte) (*ast.Program, bool) {
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, msg)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/testrunner"
+	"os"
+)
+
+// runTests runs the tests in the *_test.mk files under the given paths, or
+// under the current directory, and fails if any test does.
+func runTests(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	verbose := flags.Bool("v", false, "")
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprint(os.Stderr, USAGE)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testrunner.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files found")
+		return 1
+	}
+
+	if !testrunner.Run(files, os.Stdout, *verbose) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,217 @@
+// Package testrunner runs Monkey tests: functions bound at the top level of
+// *_test.mk files whose names start with test_. Tests fail by raising an
+// error, typically with the `assert` and `assert_eq` builtins.
+package testrunner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of one test. Line and Column give where the test
+// is defined or, if it failed, the statement that raised its Failure.
+type Result struct {
+	Name    string
+	Line    int
+	Column  int
+	Failure string
+}
+
+func (r Result) Passed() bool { return r.Failure == "" }
+
+// Discover lists the test files among paths, searching directories
+// recursively for files named *_test.mk. Files named explicitly are used
+// whatever their name.
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		found := []string{}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, "_test.mk") {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// RunFile runs the tests in the file at path in the order they are defined,
+// each in a fresh environment on top of the file's top-level bindings.
+// Output of the file and its tests goes to out. It fails if the file cannot
+// be read or parsed, or if evaluating its top level raises an error.
+func RunFile(path string, out io.Writer) ([]Result, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	base := object.NewEnvironment()
+	base.SetOutput(out)
+	tracer := newPositionTracer(token.Token{Line: 1, Column: 1})
+	base.Context().Tracer = tracer
+	if errObj, ok := evaluator.Eval(program, base).(*object.Error); ok {
+		at := tracer.failedAt()
+		return nil, fmt.Errorf("%s:%d:%d: %s", path, at.Line, at.Column, errObj.Message)
+	}
+	base.Context().Tracer = nil
+	base.Freeze()
+
+	results := []Result{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil || !strings.HasPrefix(let.Name.Value, "test_") {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+		results = append(results, runTest(let, base, out))
+	}
+	return results, nil
+}
+
+func runTest(let *ast.LetStatement, base *object.Environment, out io.Writer) Result {
+	result := Result{Name: let.Name.Value, Line: let.Token.Line, Column: let.Token.Column}
+
+	fn, _ := base.Get(let.Name.Value)
+	if fn, ok := fn.(*object.Function); ok && len(fn.Parameters) != 0 {
+		result.Failure = "test functions take no arguments"
+		return result
+	}
+
+	env := object.NewEnvironmentFrom(base)
+	env.SetOutput(out)
+	tracer := newPositionTracer(let.Token)
+	env.Context().Tracer = tracer
+
+	call := &ast.CallExpression{Token: let.Token, Function: let.Name}
+	if errObj, ok := evaluator.Eval(call, env).(*object.Error); ok {
+		at := tracer.failedAt()
+		result.Line, result.Column, result.Failure = at.Line, at.Column, errObj.Message
+	}
+	return result
+}
+
+// Run runs the tests in files, reporting each failure to out with its
+// position and error and, if verbose, each passing test. Each file ends
+// with a summary line. It reports whether every test passed.
+func Run(files []string, out io.Writer, verbose bool) bool {
+	ok := true
+	for _, path := range files {
+		results, err := RunFile(path, out)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL\t%s\t%s\n", path, err)
+			ok = false
+			continue
+		}
+
+		failed := 0
+		for _, r := range results {
+			if r.Passed() {
+				if verbose {
+					fmt.Fprintf(out, "--- PASS: %s\n", r.Name)
+				}
+				continue
+			}
+			failed++
+			fmt.Fprintf(out, "--- FAIL: %s (%s:%d:%d)\n", r.Name, path, r.Line, r.Column)
+			for _, line := range strings.Split(r.Failure, "\n") {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+		}
+
+		switch {
+		case len(results) == 0:
+			fmt.Fprintf(out, "?   \t%s\tno tests\n", path)
+		case failed > 0:
+			fmt.Fprintf(out, "FAIL\t%s\t%d of %d tests failed\n", path, failed, len(results))
+			ok = false
+		default:
+			fmt.Fprintf(out, "ok  \t%s\t%d tests passed\n", path, len(results))
+		}
+	}
+	return ok
+}
+
+// positionTracer keeps track of the statement running, so a failure can be
+// reported where it was raised rather than where it surfaced. The caller's
+// statement is restored when a call returns, unless the call was replaced
+// by a tail call, whose callee then still runs on behalf of the statement
+// that made it.
+type positionTracer struct {
+	current token.Token
+	callers []token.Token
+	failed  *token.Token
+}
+
+func newPositionTracer(start token.Token) *positionTracer {
+	return &positionTracer{current: start}
+}
+
+func (t *positionTracer) Statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	t.current = ast.StatementToken(stmt)
+	return nil
+}
+
+func (t *positionTracer) Call(fn object.Object, env *object.Environment) {
+	if _, ok := fn.(*object.Function); ok {
+		t.callers = append(t.callers, t.current)
+	}
+}
+
+func (t *positionTracer) Return(fn object.Object, result object.Object) {
+	if _, ok := result.(*object.Error); ok && t.failed == nil {
+		at := t.current
+		t.failed = &at
+	}
+	if _, ok := fn.(*object.Function); ok && len(t.callers) > 0 {
+		caller := t.callers[len(t.callers)-1]
+		t.callers = t.callers[:len(t.callers)-1]
+		if result != nil {
+			t.current = caller
+		}
+	}
+}
+
+// failedAt returns where the first error was raised, or the current
+// statement if it was not raised by a call.
+func (t *positionTracer) failedAt() token.Token {
+	if t.failed != nil {
+		return *t.failed
+	}
+	return t.current
+}
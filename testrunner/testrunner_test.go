@@ -0,0 +1,149 @@
+package testrunner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mathTests = `let double = fn(x) { x * 2 };
+let check = fn(x) {
+  assert_eq(double(x), x + x + 1)
+};
+let test_double = fn() {
+  puts("doubling");
+  assert_eq(double(2), 4)
+};
+let test_helper = fn() {
+  let a = 1;
+  check(a)
+};
+let test_nested = fn() {
+  assert_eq(double(3), 7);
+  double(0)
+};
+let test_arguments = fn(x) { x };
+let not_a_test = fn() { assert(false) };
+let test_value = 1;
+`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDiscover(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"b_test.mk":        "",
+		"a_test.mk":        "",
+		"lib.mk":           "",
+		"sub/c_test.mk":    "",
+		"sub/test_data.mk": "",
+	})
+
+	files, err := Discover([]string{dir, filepath.Join(dir, "lib.mk")})
+	if err != nil {
+		t.Fatalf("Discover failed: %s", err)
+	}
+	for i, file := range files {
+		files[i], _ = filepath.Rel(dir, file)
+	}
+	expected := []string{"a_test.mk", "b_test.mk", filepath.Join("sub", "c_test.mk"), "lib.mk"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("wrong files. want=%v, got=%v", expected, files)
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"math_test.mk": mathTests})
+
+	var out bytes.Buffer
+	results, err := RunFile(filepath.Join(dir, "math_test.mk"), &out)
+	if err != nil {
+		t.Fatalf("RunFile failed: %s", err)
+	}
+
+	expected := []Result{
+		{Name: "test_double", Line: 5, Column: 1},
+		{Name: "test_helper", Line: 3, Column: 3, Failure: "assert_eq failed\ngot:  2\nwant: 3\n      ^"},
+		{Name: "test_nested", Line: 14, Column: 3, Failure: "assert_eq failed\ngot:  6\nwant: 7\n      ^"},
+		{Name: "test_arguments", Line: 17, Column: 1, Failure: "test functions take no arguments"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("wrong results.\nwant=%+v\ngot= %+v", expected, results)
+	}
+	if out.String() != "doubling\n" {
+		t.Errorf("wrong output: %q", out.String())
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"parse_test.mk": "let = 1;",
+		"top_test.mk":   "let a = 1;\nlet b = missing + 1;\n",
+	})
+
+	for name, want := range map[string]string{
+		"parse_test.mk": "parse_test.mk: expected next token to be IDENT",
+		"top_test.mk":   "top_test.mk:2:1: identifier not found: missing",
+	} {
+		_, err := RunFile(filepath.Join(dir, name), &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ok_test.mk":    "let test_one = fn() { assert(true) };\nlet test_two = fn() { assert_eq(1, 1) };\n",
+		"empty_test.mk": "let helper = 1;\n",
+		"fail_test.mk":  "let test_fails = fn() {\n  assert(false, \"nope\")\n};\n",
+	})
+	files := []string{
+		filepath.Join(dir, "ok_test.mk"),
+		filepath.Join(dir, "empty_test.mk"),
+	}
+
+	var out bytes.Buffer
+	if !Run(files, &out, true) {
+		t.Errorf("expected passing tests to pass:\n%s", out.String())
+	}
+	expected := "--- PASS: test_one\n--- PASS: test_two\n" +
+		"ok  \t" + files[0] + "\t2 tests passed\n" +
+		"?   \t" + files[1] + "\tno tests\n"
+	if out.String() != expected {
+		t.Errorf("wrong report.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	failing := filepath.Join(dir, "fail_test.mk")
+	if Run(append(files, failing), &out, false) {
+		t.Errorf("expected a failing test to fail the run")
+	}
+	expected = "ok  \t" + files[0] + "\t2 tests passed\n" +
+		"?   \t" + files[1] + "\tno tests\n" +
+		"--- FAIL: test_fails (" + failing + ":2:3)\n" +
+		"    assertion failed: nope\n" +
+		"FAIL\t" + failing + "\t1 of 1 tests failed\n"
+	if out.String() != expected {
+		t.Errorf("wrong report.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -1,10 +1,18 @@
 package token
 
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
 type TokenType string
 
 type Token struct {
-	Type TokenType
-	Literal string
+	Type TokenType `json:"type"`
+	Literal string `json:"literal"`
+	Line int `json:"line"`
+	Column int `json:"column"`
 }
 
 const (
@@ -26,10 +34,14 @@ const (
 	GT = ">"
 	EQ = "=="
 	NOT_EQ = "!="
+	ARROW = "=>"
+	ELLIPSIS = "..."
 
 	// Delimeters
 	COMMA = ","
+	COLON = ":"
 	SEMICOLON = ";"
+	DOT = "."
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
@@ -45,6 +57,8 @@ const (
 	IF = "IF"
 	ELSE = "ELSE"
 	RETURN = "RETURN"
+	MATCH = "MATCH"
+	STRUCT = "STRUCT"
 
 	// String
 	STRING = "STRING"
@@ -58,6 +72,8 @@ var keywords = map[string]TokenType {
 	"if": IF,
 	"else": ELSE,
 	"return": RETURN,
+	"match": MATCH,
+	"struct": STRUCT,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -66,3 +82,14 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// WriteTable writes one aligned row per token giving its position, type and
+// quoted literal.
+func WriteTable(out io.Writer, tokens []Token) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "POS\tTYPE\tLITERAL")
+	for _, tok := range tokens {
+		fmt.Fprintf(w, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+	w.Flush()
+}
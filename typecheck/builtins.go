@@ -0,0 +1,119 @@
+package typecheck
+
+// polymorphic builds a scheme quantified over a single type variable.
+func polymorphic(build func(a Type) Type) *Scheme {
+	a := &TypeVariable{id: -1}
+	return &Scheme{Vars: []*TypeVariable{a}, Type: build(a)}
+}
+
+// polymorphic2 builds a scheme quantified over two type variables.
+func polymorphic2(build func(a, b Type) Type) *Scheme {
+	a, b := &TypeVariable{id: -1}, &TypeVariable{id: -2}
+	return &Scheme{Vars: []*TypeVariable{a, b}, Type: build(a, b)}
+}
+
+var builtins = map[string]*Scheme{
+	"len": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{a}, Int)
+	}),
+	"first": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a)}, a)
+	}),
+	"last": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a)}, a)
+	}),
+	"rest": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a)}, ArrayOf(a))
+	}),
+	"push": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), a}, ArrayOf(a))
+	}),
+	"map": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, ArrayOf(b))
+	}),
+	"filter": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, ArrayOf(a))
+	}),
+	"reduce": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), b, FunctionOf([]Type{b, a}, b)}, b)
+	}),
+	"each": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, Null)
+	}),
+	"find": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, a)
+	}),
+	"any": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, Bool)
+	}),
+	"all": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, Bool)
+	}),
+	"sort": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a)}, ArrayOf(a))
+	}),
+	"sort_by": polymorphic2(func(a, b Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), FunctionOf([]Type{a}, b)}, ArrayOf(a))
+	}),
+	"reverse": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a)}, ArrayOf(a))
+	}),
+	"split": {Type: FunctionOf([]Type{String, String}, ArrayOf(String))},
+	"join": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ArrayOf(a), String}, String)
+	}),
+	"trim":        {Type: FunctionOf([]Type{String}, String)},
+	"upper":       {Type: FunctionOf([]Type{String}, String)},
+	"lower":       {Type: FunctionOf([]Type{String}, String)},
+	"starts_with": {Type: FunctionOf([]Type{String, String}, Bool)},
+	"ends_with":   {Type: FunctionOf([]Type{String, String}, Bool)},
+	"replace":     {Type: FunctionOf([]Type{String, String, String}, String)},
+	"repeat":      {Type: FunctionOf([]Type{String, Int}, String)},
+	"chars":       {Type: FunctionOf([]Type{String}, ArrayOf(String))},
+	"readline":    {Type: FunctionOf([]Type{}, String)},
+	"read_all":    {Type: FunctionOf([]Type{}, String)},
+	"lines":       {Type: FunctionOf([]Type{}, IteratorOf(String))},
+	"next": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{IteratorOf(a)}, a)
+	}),
+	"spawn": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{FunctionOf([]Type{}, a)}, TaskOf(a))
+	}),
+	"await": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{TaskOf(a)}, a)
+	}),
+	"send": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ChannelOf(a), a}, Null)
+	}),
+	"recv": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ChannelOf(a)}, a)
+	}),
+	"close": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{ChannelOf(a)}, Null)
+	}),
+	"assert_eq": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{a, a}, Null)
+	}),
+	"keys": polymorphic(func(a Type) Type {
+		return FunctionOf([]Type{a}, ArrayOf(String))
+	}),
+}
+
+// variadicBuiltins accept a varying number of arguments, accept either
+// strings or arrays, or produce heterogeneous arrays or maps, none of which
+// a single function type can express. Each use gets a fresh type variable.
+var variadicBuiltins = map[string]bool{
+	"puts":           true,
+	"print":          true,
+	"format":         true,
+	"slice":          true,
+	"zip":            true,
+	"flatten":        true,
+	"substr":         true,
+	"contains":       true,
+	"index_of":       true,
+	"channel":        true,
+	"assert":         true,
+	"json_parse":     true,
+	"json_stringify": true,
+}
@@ -0,0 +1,684 @@
+// Package typecheck implements an optional Hindley-Milner style type checker
+// for Monkey programs. Unannotated code has its types inferred; annotations
+// such as `let x: int = 1` or `fn(a: string): int` are checked against the
+// inferred types. The evaluator never consults the checker, so programs stay
+// dynamically typed unless a host chooses to run it first.
+package typecheck
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", err.Line, err.Column, err.Message)
+}
+
+type scope struct {
+	store map[string]*Scheme
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{store: make(map[string]*Scheme), outer: outer}
+}
+
+func (s *scope) get(name string) (*Scheme, bool) {
+	scheme, ok := s.store[name]
+	if !ok && s.outer != nil {
+		scheme, ok = s.outer.get(name)
+	}
+	return scheme, ok
+}
+
+// pendingCheck records an operand whose type was still unknown when it was
+// checked: of a `+`, which needs int or string, or of `len`, which needs
+// string or array. Once the whole program has been seen the operand must
+// have resolved to one of those or remained polymorphic. Instantiating a
+// polymorphic binding carries the constraint over to the fresh variables.
+type pendingCheck struct {
+	tok     token.Token
+	op      string
+	operand Type
+}
+
+// Checker infers types for a sequence of programs that share one global
+// scope, which makes it suitable for checking REPL input line by line.
+type Checker struct {
+	globals     *scope
+	nextId      int
+	level       int
+	returns     []Type
+	pending     []pendingCheck
+	constraints []pendingCheck
+	errors      []*Error
+}
+
+func New() *Checker {
+	return &Checker{globals: newScope(nil)}
+}
+
+// Check infers types for every statement in program. When errors are found
+// the global bindings introduced by program are discarded, along with any
+// bindings of the type variables those globals refer to.
+func (checker *Checker) Check(program *ast.Program) []*Error {
+	saved := make(map[string]*Scheme, len(checker.globals.store))
+	variables := map[*TypeVariable]TypeVariable{}
+	for name, scheme := range checker.globals.store {
+		saved[name] = scheme
+		saveVariables(scheme.Type, variables)
+	}
+
+	checker.errors = nil
+	checker.pending = nil
+	checker.returns = nil
+	checker.constraints = checker.globalConstraints()
+
+	for _, stmt := range program.Statements {
+		checker.infer(stmt, checker.globals)
+	}
+
+	for _, check := range checker.pending {
+		checker.checkOperand(check)
+	}
+
+	if len(checker.errors) > 0 {
+		checker.globals.store = saved
+		for tv, state := range variables {
+			*tv = state
+		}
+	}
+
+	return checker.errors
+}
+
+// saveVariables records the state of every type variable reachable from t.
+// It follows instances without pruning so that every variable along a
+// chain, which path compression may later rewrite, is recorded.
+func saveVariables(t Type, saved map[*TypeVariable]TypeVariable) {
+	switch t := t.(type) {
+	case *TypeVariable:
+		if _, ok := saved[t]; ok {
+			return
+		}
+		saved[t] = *t
+		if t.instance != nil {
+			saveVariables(t.instance, saved)
+		}
+	case *TypeOperator:
+		for _, arg := range t.Args {
+			saveVariables(arg, saved)
+		}
+	}
+}
+
+// globalConstraints keeps the constraints that later programs can still
+// instantiate: those on variables quantified by a global scheme.
+// Constraints from earlier programs' local bindings, or from bindings a
+// failed check discarded, are dropped rather than carried into every later
+// Check.
+func (checker *Checker) globalConstraints() []pendingCheck {
+	quantified := map[Type]bool{}
+	for _, scheme := range checker.globals.store {
+		for _, v := range scheme.Vars {
+			quantified[v] = true
+		}
+	}
+
+	var kept []pendingCheck
+	for _, constraint := range checker.constraints {
+		if quantified[prune(constraint.operand)] {
+			kept = append(kept, constraint)
+		}
+	}
+	return kept
+}
+
+// TypeOf reports the type scheme bound to a global name.
+func (checker *Checker) TypeOf(name string) (*Scheme, bool) {
+	return checker.globals.get(name)
+}
+
+func (checker *Checker) infer(node ast.Node, env *scope) Type {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			return Null
+		}
+		return checker.infer(node.Expression, env)
+	case *ast.LetStatement:
+		checker.inferLet(node, env)
+		return Null
+	case *ast.StructStatement:
+		// Structs are not typed: a struct type and its values may be used
+		// as anything, as long as their fields are well typed.
+		env.store[node.Name.Value] = polymorphic(func(a Type) Type { return a })
+		return Null
+	case *ast.ReturnStatement:
+		val := checker.infer(node.ReturnValue, env)
+		if len(checker.returns) > 0 {
+			expected := checker.returns[len(checker.returns)-1]
+			if !unify(expected, val) {
+				checker.errorf(node.Token, "return type mismatch: expected %s, got %s", expected, val)
+			}
+		}
+		return checker.newVariable()
+	case *ast.BlockStatement:
+		var result Type = Null
+		for _, stmt := range node.Statements {
+			result = checker.infer(stmt, env)
+		}
+		return result
+	case *ast.IfExpression:
+		checker.infer(node.Condition, env)
+		consequence := checker.infer(node.Consequence, env)
+		if node.Alternative == nil {
+			// Without an else the expression is null whenever the
+			// condition is false.
+			return Null
+		}
+		alternative := checker.infer(node.Alternative, env)
+		if !unify(consequence, alternative) {
+			checker.errorf(node.Token, "if branches have different types: %s and %s", consequence, alternative)
+		}
+		return consequence
+	case *ast.MatchExpression:
+		return checker.inferMatch(node, env)
+	case *ast.PrefixExpression:
+		return checker.inferPrefix(node, env)
+	case *ast.InfixExpression:
+		return checker.inferInfix(node, env)
+	case *ast.FunctionLiteral:
+		return checker.inferFunction(node, env)
+	case *ast.CallExpression:
+		return checker.inferCall(node, env)
+	case *ast.ArrayLiteral:
+		element := checker.newVariable()
+		for _, el := range node.Elements {
+			elType := checker.infer(el, env)
+			if !unify(element, elType) {
+				checker.errorf(node.Token, "array elements have different types: %s and %s", element, elType)
+			}
+		}
+		return ArrayOf(element)
+	case *ast.IndexExpression:
+		return checker.inferIndex(node, env)
+	case *ast.SliceExpression:
+		return checker.inferSlice(node, env)
+	case *ast.StructLiteral:
+		checker.infer(node.Struct, env)
+		for _, val := range node.Values {
+			checker.infer(val, env)
+		}
+		return checker.newVariable()
+	case *ast.MemberExpression:
+		checker.infer(node.Object, env)
+		return checker.newVariable()
+	case *ast.Identifier:
+		return checker.inferIdentifier(node, env)
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	}
+
+	return checker.newVariable()
+}
+
+func (checker *Checker) inferLet(node *ast.LetStatement, env *scope) {
+	if node.Pattern != nil {
+		checker.inferLetPattern(node, env)
+		return
+	}
+
+	checker.level++
+	bound := checker.newVariable()
+	env.store[node.Name.Value] = &Scheme{Type: bound}
+
+	val := checker.infer(node.Value, env)
+	if !unify(bound, val) {
+		checker.errorf(node.Token, "cannot bind %s: %s is not %s", node.Name.Value, val, bound)
+	}
+	if node.Type != nil {
+		declared := checker.fromAnnotation(node.Type)
+		if !unify(declared, val) {
+			checker.errorf(node.Name.Token, "type mismatch: %s declared as %s, got %s", node.Name.Value, node.Type, val)
+		}
+	}
+	checker.level--
+
+	env.store[node.Name.Value] = checker.generalizeValue(bound, node.Value)
+}
+
+// inferLetPattern checks a destructuring let. The names are bound in a
+// scratch scope first so each can be generalized on its own.
+func (checker *Checker) inferLetPattern(node *ast.LetStatement, env *scope) {
+	checker.level++
+	val := checker.infer(node.Value, env)
+	if node.Type != nil {
+		declared := checker.fromAnnotation(node.Type)
+		if !unify(declared, val) {
+			checker.errorf(node.Pattern.Token, "type mismatch: %s declared as %s, got %s", node.Pattern, node.Type, val)
+		}
+	}
+	bound := newScope(env)
+	checker.bindPattern(node.Pattern, val, bound)
+	checker.level--
+
+	for name, scheme := range bound.store {
+		env.store[name] = checker.generalizeValue(scheme.Type, node.Value)
+	}
+}
+
+func (checker *Checker) inferMatch(node *ast.MatchExpression, env *scope) Type {
+	subject := checker.infer(node.Subject, env)
+	result := checker.newVariable()
+
+	for _, arm := range node.Arms {
+		armEnv := newScope(env)
+		checker.bindPattern(arm.Pattern, subject, armEnv)
+		if arm.Guard != nil {
+			checker.infer(arm.Guard, armEnv)
+		}
+
+		body := checker.infer(arm.Body, armEnv)
+		if !unify(result, body) {
+			checker.errorf(node.Token, "match arms have different types: %s and %s", result, body)
+		}
+	}
+
+	return result
+}
+
+// bindPattern unifies the shape of pattern with t and binds the names it
+// introduces in env.
+func (checker *Checker) bindPattern(pattern ast.Pattern, t Type, env *scope) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.store[pattern.Value] = &Scheme{Type: t}
+	case *ast.LiteralPattern:
+		literal := checker.infer(pattern.Value, env)
+		if !unify(t, literal) {
+			checker.errorf(pattern.Token, "pattern type mismatch: expected %s, got %s", t, literal)
+		}
+	case *ast.ArrayPattern:
+		element := checker.newVariable()
+		if !unify(t, ArrayOf(element)) {
+			checker.errorf(pattern.Token, "pattern type mismatch: expected %s, got array", t)
+			return
+		}
+		for _, el := range pattern.Elements {
+			checker.bindPattern(el, element, env)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			env.store[pattern.Rest.Value] = &Scheme{Type: t}
+		}
+	}
+}
+
+func (checker *Checker) inferFunction(node *ast.FunctionLiteral, env *scope) Type {
+	fnEnv := newScope(env)
+
+	params := []Type{}
+	for i, param := range node.Parameters {
+		var paramType Type
+		if i < len(node.ParameterTypes) && node.ParameterTypes[i] != nil {
+			paramType = checker.fromAnnotation(node.ParameterTypes[i])
+		} else {
+			paramType = checker.newVariable()
+		}
+		if i < len(node.ParameterPatterns) && node.ParameterPatterns[i] != nil {
+			checker.bindPattern(node.ParameterPatterns[i], paramType, fnEnv)
+		} else {
+			fnEnv.store[param.Value] = &Scheme{Type: paramType}
+		}
+		params = append(params, paramType)
+	}
+
+	var ret Type
+	if node.ReturnType != nil {
+		ret = checker.fromAnnotation(node.ReturnType)
+	} else {
+		ret = checker.newVariable()
+	}
+
+	checker.returns = append(checker.returns, ret)
+	body := checker.infer(node.Body, fnEnv)
+	checker.returns = checker.returns[:len(checker.returns)-1]
+
+	if !unify(ret, body) {
+		checker.errorf(node.Token, "return type mismatch: expected %s, got %s", ret, body)
+	}
+
+	return FunctionOf(params, ret)
+}
+
+func (checker *Checker) inferCall(node *ast.CallExpression, env *scope) Type {
+	fn := checker.infer(node.Function, env)
+
+	args := []Type{}
+	for _, arg := range node.Arguments {
+		args = append(args, checker.infer(arg, env))
+	}
+
+	ret := checker.newVariable()
+	if unify(fn, FunctionOf(args, ret)) {
+		return ret
+	}
+
+	switch fn := prune(fn).(type) {
+	case *TypeOperator:
+		if fn.Name != "fn" {
+			checker.errorf(node.Token, "not a function: %s", fn)
+		} else if len(fn.Args)-1 != len(args) {
+			checker.errorf(node.Token, "wrong number of arguments. got=%d, want=%d", len(args), len(fn.Args)-1)
+		} else {
+			checker.errorf(node.Token, "argument type mismatch: cannot call %s with (%s)", fn, typeList(args))
+		}
+	default:
+		checker.errorf(node.Token, "cannot call %s with (%s)", fn, typeList(args))
+	}
+
+	return ret
+}
+
+func (checker *Checker) inferIndex(node *ast.IndexExpression, env *scope) Type {
+	left := checker.infer(node.Left, env)
+	index := checker.infer(node.Index, env)
+
+	// Only arrays and strings are indexed by int. A string index into a value
+	// of unknown type, such as a map, is left unconstrained.
+	if prune(index) == String {
+		if _, unknown := prune(left).(*TypeVariable); unknown {
+			return checker.newVariable()
+		}
+	}
+
+	if !unify(index, Int) {
+		checker.errorf(node.Token, "index must be int, got %s", index)
+	}
+
+	if prune(left) == String {
+		return String
+	}
+
+	element := checker.newVariable()
+	if !unify(left, ArrayOf(element)) {
+		checker.errorf(node.Token, "index operator not supported: %s", left)
+	}
+	return element
+}
+
+func (checker *Checker) inferSlice(node *ast.SliceExpression, env *scope) Type {
+	left := checker.infer(node.Left, env)
+
+	for _, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+		if bound == nil {
+			continue
+		}
+		if boundType := checker.infer(bound, env); !unify(boundType, Int) {
+			checker.errorf(node.Token, "slice bounds must be int, got %s", boundType)
+		}
+	}
+
+	if prune(left) == String {
+		return String
+	}
+
+	if !unify(left, ArrayOf(checker.newVariable())) {
+		checker.errorf(node.Token, "slice operator not supported: %s", left)
+	}
+	return left
+}
+
+func (checker *Checker) inferPrefix(node *ast.PrefixExpression, env *scope) Type {
+	right := checker.infer(node.Right, env)
+
+	switch node.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if !unify(right, Int) {
+			checker.errorf(node.Token, "unknown operator: -%s", right)
+		}
+		return Int
+	default:
+		checker.errorf(node.Token, "unknown operator: %s%s", node.Operator, right)
+		return checker.newVariable()
+	}
+}
+
+func (checker *Checker) inferInfix(node *ast.InfixExpression, env *scope) Type {
+	left := checker.infer(node.Left, env)
+	right := checker.infer(node.Right, env)
+
+	if !unify(left, right) {
+		checker.errorf(node.Token, "type mismatch: %s %s %s", left, node.Operator, right)
+		return checker.newVariable()
+	}
+
+	switch node.Operator {
+	case "+":
+		checker.constrain(pendingCheck{tok: node.Token, op: "+", operand: left})
+		return left
+	case "-", "*", "/":
+		if !unify(left, Int) {
+			checker.errorf(node.Token, "unknown operator: %s %s %s", left, node.Operator, right)
+		}
+		return Int
+	case "<", ">":
+		if !unify(left, Int) {
+			checker.errorf(node.Token, "unknown operator: %s %s %s", left, node.Operator, right)
+		}
+		return Bool
+	case "==", "!=":
+		return Bool
+	default:
+		checker.errorf(node.Token, "unknown operator: %s %s %s", left, node.Operator, right)
+		return checker.newVariable()
+	}
+}
+
+// constrain checks an operand now if its type is known and once the
+// program has been seen otherwise.
+func (checker *Checker) constrain(check pendingCheck) {
+	if _, unknown := prune(check.operand).(*TypeVariable); unknown {
+		checker.pending = append(checker.pending, check)
+		checker.constraints = append(checker.constraints, check)
+	} else {
+		checker.checkOperand(check)
+	}
+}
+
+func (checker *Checker) checkOperand(check pendingCheck) {
+	operand, ok := prune(check.operand).(*TypeOperator)
+	if !ok {
+		return
+	}
+	switch check.op {
+	case "+":
+		if operand != Int && operand != String {
+			checker.errorf(check.tok, "unknown operator: %s + %s", operand, operand)
+		}
+	case "len":
+		if operand != String && operand.Name != "array" {
+			checker.errorf(check.tok, "argument type mismatch: len needs string or array, got %s", operand)
+		}
+	}
+}
+
+func (checker *Checker) inferIdentifier(node *ast.Identifier, env *scope) Type {
+	if scheme, ok := env.get(node.Value); ok {
+		return checker.instantiate(scheme)
+	}
+
+	if scheme, ok := builtins[node.Value]; ok {
+		t := checker.instantiate(scheme)
+		if node.Value == "len" {
+			// The scheme cannot say string or array, so len is checked like
+			// an operator.
+			checker.constrain(pendingCheck{tok: node.Token, op: "len", operand: t.(*TypeOperator).Args[0]})
+		}
+		return t
+	}
+
+	if variadicBuiltins[node.Value] {
+		return checker.newVariable()
+	}
+
+	checker.errorf(node.Token, "identifier not found: %s", node.Value)
+	return checker.newVariable()
+}
+
+func (checker *Checker) fromAnnotation(annotation ast.TypeExpression) Type {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		switch annotation.Name {
+		case "int":
+			return Int
+		case "string":
+			return String
+		case "bool":
+			return Bool
+		case "null":
+			return Null
+		case "any":
+			return checker.newVariable()
+		}
+		checker.errorf(annotation.Token, "unknown type: %s", annotation.Name)
+	case *ast.ArrayType:
+		return ArrayOf(checker.fromAnnotation(annotation.Element))
+	case *ast.FunctionType:
+		params := []Type{}
+		for _, p := range annotation.Parameters {
+			params = append(params, checker.fromAnnotation(p))
+		}
+		return FunctionOf(params, checker.fromAnnotation(annotation.Return))
+	}
+
+	return checker.newVariable()
+}
+
+func (checker *Checker) newVariable() *TypeVariable {
+	tv := &TypeVariable{id: checker.nextId, level: checker.level}
+	checker.nextId++
+	return tv
+}
+
+// generalizeValue generalizes the type of a let binding only when its value
+// is a syntactic value. The result of a call may be a channel or task whose
+// element type must stay fixed, so it is bound monomorphically.
+func (checker *Checker) generalizeValue(t Type, value ast.Expression) *Scheme {
+	if isSyntacticValue(value) {
+		return checker.generalize(t)
+	}
+
+	adjustLevels(t, checker.level)
+	return &Scheme{Type: t}
+}
+
+func isSyntacticValue(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.FunctionLiteral, *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			if !isSyntacticValue(el) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (checker *Checker) generalize(t Type) *Scheme {
+	vars := []*TypeVariable{}
+	seen := map[*TypeVariable]bool{}
+
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *TypeVariable:
+			if t.level > checker.level && !seen[t] {
+				seen[t] = true
+				vars = append(vars, t)
+			}
+		case *TypeOperator:
+			for _, arg := range t.Args {
+				collect(arg)
+			}
+		}
+	}
+	collect(t)
+
+	return &Scheme{Vars: vars, Type: t}
+}
+
+func (checker *Checker) instantiate(scheme *Scheme) Type {
+	if len(scheme.Vars) == 0 {
+		return scheme.Type
+	}
+
+	mapping := map[*TypeVariable]Type{}
+	for _, v := range scheme.Vars {
+		fresh := checker.newVariable()
+		mapping[v] = fresh
+		for _, constraint := range checker.constraints {
+			if prune(constraint.operand) == v {
+				checker.pending = append(checker.pending, pendingCheck{tok: constraint.tok, op: constraint.op, operand: fresh})
+			}
+		}
+	}
+
+	var copyType func(t Type) Type
+	copyType = func(t Type) Type {
+		switch t := prune(t).(type) {
+		case *TypeVariable:
+			if replacement, ok := mapping[t]; ok {
+				return replacement
+			}
+			return t
+		case *TypeOperator:
+			if len(t.Args) == 0 {
+				return t
+			}
+			args := make([]Type, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = copyType(arg)
+			}
+			return &TypeOperator{Name: t.Name, Args: args}
+		}
+		return t
+	}
+
+	return copyType(scheme.Type)
+}
+
+func (checker *Checker) errorf(tok token.Token, format string, a ...interface{}) {
+	checker.errors = append(checker.errors, &Error{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func typeList(types []Type) string {
+	out := ""
+	for i, t := range types {
+		if i > 0 {
+			out += ", "
+		}
+		out += t.String()
+	}
+	return out
+}
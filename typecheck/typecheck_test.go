@@ -0,0 +1,171 @@
+package typecheck
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestInferredTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected string
+	}{
+		{"let x = 5;", "x", "int"},
+		{`let s = "a" + "b";`, "s", "string"},
+		{"let b = 1 < 2;", "b", "bool"},
+		{"let size = fn(x) { len(x) }; let n = size(\"ab\") + size([1]);", "size", "fn('a): int"},
+		{"let xs = [1, 2, 3];", "xs", "[int]"},
+		{"let add = fn(a, b) { a + b };", "add", "fn('a, 'a): 'a"},
+		{"let double = fn(x) { x * 2 };", "double", "fn(int): int"},
+		{"let id = fn(x) { x }; let n = id(1); let s = id(\"s\");", "s", "string"},
+		{"let apply = fn(f, x) { f(x) };", "apply", "fn(fn('a): 'b, 'a): 'b"},
+		{"let head = fn(xs) { xs[0] };", "head", "fn(['a]): 'a"},
+		{"let get = fn(m) { m[\"key\"] };", "get", "fn('a): 'b"},
+		{"let count = fn(m) { m[\"count\"] + 1 };", "count", "fn('a): int"},
+		{"let fact = fn(n) { if (n < 2) { return 1; } n * fact(n - 1) };", "fact", "fn(int): int"},
+		{"let x = if (true) { 1 };", "x", "null"},
+		{"let f = fn(a: string): int { len(a) };", "f", "fn(string): int"},
+		{"let xs: [int] = [];", "xs", "[int]"},
+		{"let xs = push([], true);", "xs", "[bool]"},
+		{"let tail = fn(xs) { xs[1:] };", "tail", "fn(['a]): ['a]"},
+		{`let s = "abc"[::-1];`, "s", "string"},
+		{"let sum = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + sum(t) } };", "sum", "fn([int]): int"},
+		{"let [a, b] = [1, 2];", "b", "int"},
+		{"let [h, ...t] = [\"a\"];", "t", "[string]"},
+		{"let [f] = [fn(x) { x }]; let n = f(1); let s = f(\"s\");", "s", "string"},
+		{"let sum = fn([a, b]) { a + b };", "sum", "fn(['a]): 'a"},
+		{"let t = spawn(fn() { \"done\" });", "t", "task(string)"},
+		{"let n = await(spawn(fn() { 1 }));", "n", "int"},
+		{"let ch = channel(); send(ch, true); let v = recv(ch);", "v", "bool"},
+		{`let name = fn(n) { match (n) { 1 => "one", x if x > 1 => "many", _ => "none" } };`, "name", "fn(int): string"},
+		{"struct Point { x, y } let p = Point(1, 2); let q = p{x: 3}; let n = p.x + 1;", "n", "int"},
+	}
+
+	for _, tt := range tests {
+		checker := New()
+		errors := checker.Check(parse(t, tt.input))
+		if len(errors) != 0 {
+			t.Errorf("%q: unexpected type errors: %v", tt.input, errors)
+			continue
+		}
+
+		typ, ok := checker.TypeOf(tt.name)
+		if !ok {
+			t.Errorf("%q: %s not bound", tt.input, tt.name)
+			continue
+		}
+		if typ.String() != tt.expected {
+			t.Errorf("%q: wrong type for %s. expected=%q, got=%q", tt.input, tt.name, tt.expected, typ.String())
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`5 + "a"`, "1:3: type mismatch: int + string"},
+		{"true + false", "1:6: unknown operator: bool + bool"},
+		{"-true", "1:1: unknown operator: -bool"},
+		{"let x: int = \"a\";", "1:5: type mismatch: x declared as int, got string"},
+		{"let f = fn(a: string) { a }; f(1);", "1:31: argument type mismatch: cannot call fn(string): string with (int)"},
+		{"let f = fn(a) { a }; f(1, 2);", "1:23: wrong number of arguments. got=2, want=1"},
+		{"1(2)", "1:2: not a function: int"},
+		{"[1, true]", "1:1: array elements have different types: int and bool"},
+		{"if (true) { 1 } else { \"a\" }", "1:1: if branches have different types: int and string"},
+		{"let x = if (true) { 1 }; x + 1", "1:28: type mismatch: null + int"},
+		{"let f = fn(): int { return \"a\"; 1 };", "1:21: return type mismatch: expected int, got string"},
+		{"let f = fn(x) { x + x }; f(true);", "1:19: unknown operator: bool + bool"},
+		{"foobar", "1:1: identifier not found: foobar"},
+		{"let x: float = 1;", "1:8: unknown type: float"},
+		{"[1][\"a\"]", "1:4: index must be int, got string"},
+		{"let x = 1; x[\"a\"]", "1:13: index must be int, got string"},
+		{"[1][true:]", "1:4: slice bounds must be int, got bool"},
+		{"1[1:]", "1:2: slice operator not supported: int"},
+		{`match (1) { 1 => 1, _ => "a" }`, "1:1: match arms have different types: int and string"},
+		{`match (1) { "a" => 1 }`, "1:13: pattern type mismatch: expected int, got string"},
+		{`match (1) { [a] => 1 }`, "1:13: pattern type mismatch: expected int, got array"},
+		{"let ch = channel(); send(ch, 1); send(ch, \"a\");", "1:38: argument type mismatch: cannot call fn(channel(int), int): null with (channel(int), string)"},
+		{"let f = fn(x) { x }; let g = f(fn(y) { y }); g(1); g(\"s\");", "1:53: argument type mismatch: cannot call fn(int): int with (string)"},
+		{"let [a, b] = 1;", "1:5: pattern type mismatch: expected int, got array"},
+		{"let [a]: [int] = [\"a\"];", "1:5: type mismatch: [a] declared as [int], got [string]"},
+		{"let f = fn([a, b]) { a + 1 }; f(1);", "1:32: argument type mismatch: cannot call fn([int]): int with (int)"},
+		{"struct Point { x, y } Point{x: 1 + true, y: 2}", "1:34: type mismatch: int + bool"},
+		{"len(5)", "1:1: argument type mismatch: len needs string or array, got int"},
+		{"let size = fn(x) { len(x) }; size(true);", "1:20: argument type mismatch: len needs string or array, got bool"},
+		{"map([1, 2], len)", "1:13: argument type mismatch: len needs string or array, got int"},
+	}
+
+	for _, tt := range tests {
+		errors := New().Check(parse(t, tt.input))
+		if len(errors) == 0 {
+			t.Errorf("%q: expected type error %q, got none", tt.input, tt.expected)
+			continue
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestCheckDiscardsBindingsOnError(t *testing.T) {
+	checker := New()
+	if errors := checker.Check(parse(t, "let x = 1;")); len(errors) != 0 {
+		t.Fatalf("unexpected type errors: %v", errors)
+	}
+	if errors := checker.Check(parse(t, `let x = "a"; x + 1;`)); len(errors) == 0 {
+		t.Fatalf("expected type error")
+	}
+
+	typ, _ := checker.TypeOf("x")
+	if typ.String() != "int" {
+		t.Errorf("x was rebound after failed check. got=%s", typ)
+	}
+}
+
+func TestCheckUndoesSubstitutionsOnError(t *testing.T) {
+	checker := New()
+	if errors := checker.Check(parse(t, "let xs = rest([]);")); len(errors) != 0 {
+		t.Fatalf("unexpected type errors: %v", errors)
+	}
+	if errors := checker.Check(parse(t, "xs[0] + 1; 1 + true;")); len(errors) == 0 {
+		t.Fatalf("expected type error")
+	}
+	if errors := checker.Check(parse(t, `xs[0] + "a";`)); len(errors) != 0 {
+		t.Errorf("failed check left the type of xs bound. got=%v", errors)
+	}
+}
+
+func TestCheckerDropsStaleConstraints(t *testing.T) {
+	checker := New()
+	if errors := checker.Check(parse(t, "let add = fn(a, b) { a + b };")); len(errors) != 0 {
+		t.Fatalf("unexpected type errors: %v", errors)
+	}
+	for i := 0; i < 10; i++ {
+		input := "let f = fn(x) { let g = fn(y) { y + y }; g(x) }; f(1);"
+		if errors := checker.Check(parse(t, input)); len(errors) != 0 {
+			t.Fatalf("unexpected type errors: %v", errors)
+		}
+	}
+
+	errors := checker.Check(parse(t, "add(true, false);"))
+	if len(checker.constraints) != 1 {
+		t.Errorf("checker kept %d constraints, want only the one of add", len(checker.constraints))
+	}
+	if len(errors) == 0 || errors[0].Error() != "1:24: unknown operator: bool + bool" {
+		t.Errorf("expected add to keep its constraint, got=%v", errors)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,198 @@
+package typecheck
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a Monkey type as seen by the checker: either a type variable or a
+// type operator applied to zero or more argument types.
+type Type interface {
+	String() string
+}
+
+// TypeVariable is an unknown type that is resolved through unification.
+// Variables created at a deeper let-level than the current one are
+// generalised when the binding is added to the environment.
+type TypeVariable struct {
+	id       int
+	level    int
+	instance Type
+}
+
+// TypeOperator is a concrete type constructor. Functions use the name "fn"
+// with the return type as the last argument; arrays use "array".
+type TypeOperator struct {
+	Name string
+	Args []Type
+}
+
+// Scheme is a possibly polymorphic type: Vars are quantified in Type.
+type Scheme struct {
+	Vars []*TypeVariable
+	Type Type
+}
+
+var (
+	Int    = &TypeOperator{Name: "int"}
+	String = &TypeOperator{Name: "string"}
+	Bool   = &TypeOperator{Name: "bool"}
+	Null   = &TypeOperator{Name: "null"}
+)
+
+func ArrayOf(element Type) *TypeOperator {
+	return &TypeOperator{Name: "array", Args: []Type{element}}
+}
+
+func IteratorOf(element Type) *TypeOperator {
+	return &TypeOperator{Name: "iterator", Args: []Type{element}}
+}
+
+func TaskOf(result Type) *TypeOperator {
+	return &TypeOperator{Name: "task", Args: []Type{result}}
+}
+
+func ChannelOf(element Type) *TypeOperator {
+	return &TypeOperator{Name: "channel", Args: []Type{element}}
+}
+
+func FunctionOf(params []Type, ret Type) *TypeOperator {
+	args := make([]Type, 0, len(params)+1)
+	args = append(args, params...)
+	args = append(args, ret)
+	return &TypeOperator{Name: "fn", Args: args}
+}
+
+func (tv *TypeVariable) String() string {
+	if tv.instance != nil {
+		return tv.instance.String()
+	}
+	return variableName(tv.id)
+}
+
+func (op *TypeOperator) String() string {
+	switch op.Name {
+	case "array":
+		return "[" + op.Args[0].String() + "]"
+	case "iterator", "task", "channel":
+		return op.Name + "(" + op.Args[0].String() + ")"
+	case "fn":
+		params := []string{}
+		for _, p := range op.Args[:len(op.Args)-1] {
+			params = append(params, p.String())
+		}
+		return fmt.Sprintf("fn(%s): %s", strings.Join(params, ", "), op.Args[len(op.Args)-1])
+	default:
+		return op.Name
+	}
+}
+
+// String prints the scheme with its variables renamed 'a, 'b, ... in order
+// of appearance.
+func (scheme *Scheme) String() string {
+	names := map[*TypeVariable]int{}
+
+	var show func(t Type) string
+	show = func(t Type) string {
+		switch t := prune(t).(type) {
+		case *TypeVariable:
+			if _, ok := names[t]; !ok {
+				names[t] = len(names)
+			}
+			return variableName(names[t])
+		case *TypeOperator:
+			args := make([]Type, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = shown(show(arg))
+			}
+			return (&TypeOperator{Name: t.Name, Args: args}).String()
+		}
+		return t.String()
+	}
+
+	return show(scheme.Type)
+}
+
+// shown is an already rendered type, used when printing schemes.
+type shown string
+
+func (s shown) String() string { return string(s) }
+
+func variableName(id int) string {
+	name := string(rune('a' + id%26))
+	if id >= 26 {
+		name += fmt.Sprintf("%d", id/26)
+	}
+	return "'" + name
+}
+
+// prune follows instantiated type variables to the type they stand for.
+func prune(t Type) Type {
+	if tv, ok := t.(*TypeVariable); ok && tv.instance != nil {
+		tv.instance = prune(tv.instance)
+		return tv.instance
+	}
+	return t
+}
+
+func occursIn(tv *TypeVariable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *TypeVariable:
+		return t == tv
+	case *TypeOperator:
+		for _, arg := range t.Args {
+			if occursIn(tv, arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// adjustLevels lowers the level of every free variable in t so that it is
+// not generalised past the binding of tv.
+func adjustLevels(t Type, level int) {
+	switch t := prune(t).(type) {
+	case *TypeVariable:
+		if t.level > level {
+			t.level = level
+		}
+	case *TypeOperator:
+		for _, arg := range t.Args {
+			adjustLevels(arg, level)
+		}
+	}
+}
+
+// unify makes a and b equal, instantiating type variables as needed. It
+// reports false if the types cannot be made equal.
+func unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+
+	if av, ok := a.(*TypeVariable); ok {
+		if av == b {
+			return true
+		}
+		if occursIn(av, b) {
+			return false
+		}
+		adjustLevels(b, av.level)
+		av.instance = b
+		return true
+	}
+
+	if _, ok := b.(*TypeVariable); ok {
+		return unify(b, a)
+	}
+
+	aop, bop := a.(*TypeOperator), b.(*TypeOperator)
+	if aop.Name != bop.Name || len(aop.Args) != len(bop.Args) {
+		return false
+	}
+	for i := range aop.Args {
+		if !unify(aop.Args[i], bop.Args[i]) {
+			return false
+		}
+	}
+	return true
+}